@@ -0,0 +1,183 @@
+package main
+
+import (
+	"./crawler"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// single broken link target, with every page linking to it
+type BrokenLink struct {
+	Url       string
+	Error     string
+	Referrers []string
+}
+
+// broken link checker: collects source -> target pairs and results of each target, writes report of broken targets at the end
+type checkWriter struct {
+	out       io.Writer
+	indent    bool
+	ndjson    bool
+	mutex     *sync.Mutex
+	referrers map[string]map[string]struct{}
+	broken    map[string]string
+	failed    map[string]string
+}
+
+func newCheckWriter(out io.Writer, indent bool, ndjson bool) (w *checkWriter) {
+	w = new(checkWriter)
+	w.out = out
+	w.indent = indent
+	w.ndjson = ndjson
+	w.mutex = &sync.Mutex{}
+	w.referrers = make(map[string]map[string]struct{})
+	w.broken = make(map[string]string)
+	w.failed = make(map[string]string)
+	return
+}
+
+func (w *checkWriter) begin() error {
+	return nil
+}
+
+// a target is broken if it could not be fetched, returned 4xx/5xx, or its redirects led nowhere
+// link errors of a page that loaded fine, hash loops and targets skipped because of robots.txt or scope do not count
+// neither do fetches aborted because the crawl was interrupted
+// failures of the crawler itself, e.g. of the SeenStore or a hook, say nothing about the target, they are kept apart in failed
+func (w *checkWriter) write(u *crawler.FoundUrls) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	// a page linking the same target more than once is listed once
+	for _, aurl := range u.FoundUrls {
+		if w.referrers[*aurl] == nil {
+			w.referrers[*aurl] = make(map[string]struct{})
+		}
+		w.referrers[*aurl][u.CrawlUrl] = struct{}{}
+	}
+	if u.Err == nil || u.Skipped != "" || errors.Is(u.Err, context.Canceled) == true {
+		return nil
+	}
+	var statusErr *crawler.HTTPStatusError
+	var fetchErr *crawler.FetchError
+	var robotsErr *crawler.RobotsDisallowedError
+	var scopeErr *crawler.ScopeError
+	var redirectErr *crawler.RedirectError
+	var seenErr *crawler.SeenStoreError
+	var panicErr *crawler.HookPanicError
+	switch {
+	case errors.As(u.Err, &seenErr), errors.As(u.Err, &panicErr):
+		w.failed[u.CrawlUrl] = u.Err.Error()
+	case errors.As(u.Err, &statusErr), errors.As(u.Err, &fetchErr), errors.As(u.Err, &redirectErr):
+		w.broken[u.CrawlUrl] = u.Err.Error()
+	case errors.As(u.Err, &robotsErr), errors.As(u.Err, &scopeErr):
+	case u.StatusCode == 0:
+		w.broken[u.CrawlUrl] = u.Err.Error()
+	}
+	return nil
+}
+
+// URLs which could not be checked because of a crawler failure, sorted, as "url: error"
+func (w *checkWriter) failures() (failures []string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for aurl, failure := range w.failed {
+		failures = append(failures, aurl+": "+failure)
+	}
+	sort.Strings(failures)
+	return
+}
+
+// number of broken targets found so far
+func (w *checkWriter) brokenCount() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return len(w.broken)
+}
+
+// referrers and results collected so far, the report is only written at the end
+type checkState struct {
+	Referrers map[string][]string
+	Broken    map[string]string
+	Failed    map[string]string
+}
+
+func (w *checkWriter) saveState() ([]byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	state := &checkState{Referrers: make(map[string][]string, len(w.referrers)), Broken: w.broken, Failed: w.failed}
+	for target, referrers := range w.referrers {
+		for referrer := range referrers {
+			state.Referrers[target] = append(state.Referrers[target], referrer)
+		}
+	}
+	return json.Marshal(state)
+}
+
+// report of a resumed crawl covers the whole crawl, wherever the output goes
+func (w *checkWriter) loadState(state []byte, continued bool) (err error) {
+	saved := new(checkState)
+	err = json.Unmarshal(state, saved)
+	if err != nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for target, referrers := range saved.Referrers {
+		w.referrers[target] = make(map[string]struct{}, len(referrers))
+		for _, referrer := range referrers {
+			w.referrers[target][referrer] = struct{}{}
+		}
+	}
+	for target, brokenErr := range saved.Broken {
+		w.broken[target] = brokenErr
+	}
+	for target, failure := range saved.Failed {
+		w.failed[target] = failure
+	}
+	return
+}
+
+// writes report, sorted by URL, as a json array or one object per line
+func (w *checkWriter) end() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var urls []string
+	for aurl := range w.broken {
+		urls = append(urls, aurl)
+	}
+	sort.Strings(urls)
+	report := make([]*BrokenLink, 0, len(urls))
+	for _, aurl := range urls {
+		referrers := make([]string, 0, len(w.referrers[aurl]))
+		for referrer := range w.referrers[aurl] {
+			referrers = append(referrers, referrer)
+		}
+		sort.Strings(referrers)
+		report = append(report, &BrokenLink{Url: aurl, Error: w.broken[aurl], Referrers: referrers})
+	}
+	if w.ndjson == true {
+		enc := json.NewEncoder(w.out)
+		for _, link := range report {
+			err = enc.Encode(link)
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	var b []byte
+	if w.indent == true {
+		b, err = json.MarshalIndent(report, "", "\t")
+	} else {
+		b, err = json.Marshal(report)
+	}
+	if err != nil {
+		return
+	}
+	_, err = w.out.Write(append(b, '\n'))
+	return
+}
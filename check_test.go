@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+import "./crawler"
+
+func TestCheckWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newCheckWriter(&buf, false, false)
+	a, b, ext := "http://a/", "http://a/b", "http://ext/"
+	_ = w.begin()
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: a, StatusCode: 200, FoundUrls: []*string{&b, &ext}})
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: b, StatusCode: 200, FoundUrls: []*string{&ext, &ext}, LinkErrors: []error{&crawler.ParseLinkError{Base: b, Link: "%", Err: errors.New("invalid URL escape")}}})
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "http://a/loop", StatusCode: 200, Err: &crawler.HashLoopError{Url: "http://a/loop", DuplicateOf: a}})
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: ext, CheckOnly: true, StatusCode: 404, Err: &crawler.HTTPStatusError{Url: ext, StatusCode: 404}})
+	// aborted by SIGINT, not broken
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "http://a/c", Err: fmt.Errorf("doHttpRequest: %w", &crawler.FetchError{Url: "http://a/c", Op: "http.Do", Err: context.Canceled})})
+	// failure of the crawler, not of the target
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "http://a/d", Err: &crawler.SeenStoreError{Url: "http://a/d", Err: errors.New("disk full")}})
+	_ = w.end()
+	var report []BrokenLink
+	err := json.Unmarshal(buf.Bytes(), &report)
+	if err != nil || w.brokenCount() != 1 || len(report) != 1 || report[0].Url != ext || len(report[0].Referrers) != 2 || report[0].Referrers[1] != b {
+		t.Errorf("%s: %s", err, buf.String())
+	}
+	if failures := w.failures(); len(failures) != 1 || strings.HasPrefix(failures[0], "http://a/d: ") == false {
+		t.Errorf("failures: %q", failures)
+	}
+}
+
+func TestCheckWriterState(t *testing.T) {
+	// broken links and referrers found before the interrupt are in the report of the resumed crawl
+	a, b, ext := "http://a/", "http://a/b", "http://ext/"
+	w := newCheckWriter(new(bytes.Buffer), false, false)
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: a, StatusCode: 200, FoundUrls: []*string{&b, &ext}})
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: ext, CheckOnly: true, StatusCode: 404, Err: &crawler.HTTPStatusError{Url: ext, StatusCode: 404}})
+	state, err := w.saveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w = newCheckWriter(&buf, false, false)
+	if err = w.loadState(state, false); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: b, StatusCode: 200, FoundUrls: []*string{&ext}})
+	_ = w.end()
+	var report []BrokenLink
+	err = json.Unmarshal(buf.Bytes(), &report)
+	if err != nil || w.brokenCount() != 1 || len(report) != 1 || report[0].Url != ext || len(report[0].Referrers) != 2 {
+		t.Errorf("%s: %s", err, buf.String())
+	}
+}
@@ -0,0 +1,237 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version of the checkpoint file format
+const checkpointVersion = 3
+
+// state of the caller saved in each checkpoint along with the crawl state, see Crawler.CheckpointData
+// Save is called while no callback is running, so the saved state matches the URLs reported up to that point
+// Load is called by Resume with what the last Save wrote, before the crawl continues
+type CheckpointData interface {
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// first line of a checkpoint file
+// followed by the queued jobs, one spill file line each, an empty line,
+// the size of the saved CheckpointData on its own line and the data itself, then the saved SeenStore
+type checkpointState struct {
+	Version        int
+	BaseUrl        string
+	SiteRoot       string `json:",omitempty"`
+	Saved          time.Time
+	Crawled        int64
+	Hashes         map[string]string    `json:",omitempty"`
+	NearDuplicates []savedNearDuplicate `json:",omitempty"`
+	TrapVariants   map[string][]uint64  `json:",omitempty"`
+}
+
+// saves crawl state to w.checkpoint, the frontier must be paused or closed so nothing is in flight
+// written to a temporary file first, an interrupted save leaves the previous checkpoint in place
+func (w *crawlWorker) saveCheckpoint() (err error) {
+	state := &checkpointState{Version: checkpointVersion, BaseUrl: w.baseUrl, Saved: time.Now(), Crawled: w.crawled.Load()}
+	if w.siteRoot != nil {
+		state.SiteRoot = w.siteRoot.String()
+	}
+	w.hashMutex.Lock()
+	state.Hashes = make(map[string]string, len(w.crawledUrlHash))
+	for sum, hashUrl := range w.crawledUrlHash {
+		state.Hashes[hex.EncodeToString(sum[:])] = hashUrl
+	}
+	w.hashMutex.Unlock()
+	if w.nearDuplicates != nil {
+		state.NearDuplicates = w.nearDuplicates.save()
+	}
+	state.TrapVariants = w.traps.saveVariants()
+
+	tmp := w.checkpoint + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return makeError("checkpoint: %s", err)
+	}
+	bw := bufio.NewWriter(f)
+	err = json.NewEncoder(bw).Encode(state)
+	if err == nil {
+		err = w.frontier.snapshot(bw)
+	}
+	if err == nil {
+		_, err = bw.WriteString("\n")
+	}
+	if err == nil {
+		err = w.saveCheckpointData(bw)
+	}
+	if err == nil {
+		err = w.seen.(CheckpointSeenStore).Save(bw)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	errC := f.Close()
+	if err == nil {
+		err = errC
+	}
+	if err == nil {
+		err = os.Rename(tmp, w.checkpoint)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return makeError("checkpoint: %s", err)
+	}
+	return
+}
+
+// writes Crawler.CheckpointData prefixed with its size, 0 if not set
+func (w *crawlWorker) saveCheckpointData(bw *bufio.Writer) (err error) {
+	data := new(bytes.Buffer)
+	if w.crawler.CheckpointData != nil {
+		err = w.crawler.CheckpointData.Save(data)
+		if err != nil {
+			return makeError("CheckpointData: %s", err)
+		}
+	}
+	_, err = fmt.Fprintf(bw, "%d\n", data.Len())
+	if err == nil {
+		_, err = data.WriteTo(bw)
+	}
+	return
+}
+
+// reads what saveCheckpointData wrote, passing it to Crawler.CheckpointData if set, leaves br positioned at the saved SeenStore
+func (w *crawlWorker) loadCheckpointData(br *bufio.Reader) (err error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return makeError("read CheckpointData: %s", err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSuffix(line, "\n"), 10, 64)
+	if err != nil {
+		return makeError("read CheckpointData: %s", err)
+	}
+	data := io.LimitReader(br, size)
+	if w.crawler.CheckpointData != nil {
+		err = w.crawler.CheckpointData.Load(data)
+		if err != nil {
+			return makeError("CheckpointData: %s", err)
+		}
+	}
+	// whatever Load did not read
+	_, err = io.Copy(io.Discard, data)
+	return
+}
+
+// reads the first line of a checkpoint file, returns the reader positioned at the queued jobs
+func readCheckpoint(checkpoint string) (state *checkpointState, f *os.File, br *bufio.Reader, err error) {
+	f, err = os.Open(checkpoint)
+	if err != nil {
+		return nil, nil, nil, makeError("checkpoint: %s", err)
+	}
+	br = bufio.NewReader(f)
+	line, err := br.ReadBytes('\n')
+	if err == nil {
+		state = new(checkpointState)
+		err = json.Unmarshal(line, state)
+	}
+	if err == nil && state.Version != checkpointVersion {
+		err = makeError("unsupported version %d", state.Version)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, nil, makeError("checkpoint %s: %s", checkpoint, err)
+	}
+	return
+}
+
+// returns the URL the crawl saved in checkpoint was started with
+func CheckpointUrl(checkpoint string) (baseUrl string, err error) {
+	state, f, _, err := readCheckpoint(checkpoint)
+	if err != nil {
+		return
+	}
+	_ = f.Close()
+	return state.BaseUrl, nil
+}
+
+// reads queued jobs saved in a checkpoint, passing each to fn as it is read, up to the empty line ending them
+// leaves br positioned at the saved SeenStore
+func readCheckpointFrontier(br *bufio.Reader, fn func(job crawlJob)) (err error) {
+	for {
+		line, errR := br.ReadString('\n')
+		if errR != nil {
+			return makeError("read frontier: %s", errR)
+		}
+		if line == "\n" {
+			return
+		}
+		job, ok := parseSpillLine(line)
+		if ok == false {
+			return makeError("read frontier: invalid line %q", line)
+		}
+		fn(job)
+	}
+}
+
+// continues the crawl saved in checkpoint by Crawler.Checkpoint, until done or until ctx is cancelled
+// URLs reported before the checkpoint was saved are not crawled or reported again, queued ones are crawled with their saved depth
+// Crawler.SeenStore must be of the same kind as the one used when saving, other settings should be the same as well
+// keeps saving checkpoints to Crawler.Checkpoint, or to checkpoint if that is empty
+// Crawler.CheckpointData, if set, is loaded with the data saved in the checkpoint before the crawl continues
+func (c *Crawler) Resume(ctx context.Context, checkpoint string, callbackFunc func(*FoundUrls)) (err error) {
+	state, f, br, err := readCheckpoint(checkpoint)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	w := newCrawlWorkerSite(ctx, c, state.BaseUrl, state.SiteRoot, callbackFunc)
+	if w.checkpoint == "" {
+		w.checkpoint = checkpoint
+	}
+	seen, ok := w.seen.(CheckpointSeenStore)
+	if ok == false {
+		return makeError("checkpoint: SeenStore does not implement CheckpointSeenStore")
+	}
+	// queued jobs are pushed as they are read, the frontier spills them to disk beyond Crawler.FrontierMemoryLimit
+	err = readCheckpointFrontier(br, func(job crawlJob) {
+		w.frontier.push(job)
+	})
+	if err == nil {
+		err = w.loadCheckpointData(br)
+	}
+	if err == nil {
+		err = seen.Load(br)
+	}
+	if err != nil {
+		// removes the spill file of jobs pushed so far
+		w.frontier.close()
+		return makeError("checkpoint %s: %s", checkpoint, err)
+	}
+	for hexSum, hashUrl := range state.Hashes {
+		var sum [sha256.Size]byte
+		if b, errH := hex.DecodeString(hexSum); errH == nil && len(b) == sha256.Size {
+			copy(sum[:], b)
+			w.crawledUrlHash[sum] = hashUrl
+		}
+	}
+	if w.nearDuplicates != nil {
+		w.nearDuplicates.load(state.NearDuplicates)
+	}
+	w.traps.loadVariants(state.TrapVariants)
+	w.crawled.Store(state.Crawled)
+	w.startWorkers()
+	return w.waitForWorkers()
+}
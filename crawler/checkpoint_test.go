@@ -0,0 +1,210 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// binary tree of n pages, page i links to 2i+1 and 2i+2, page 0 is also the root
+func checkpointTestPages(n int) map[string]*MemoryPage {
+	pages := make(map[string]*MemoryPage)
+	for i := 0; i < n; i++ {
+		body := fmt.Sprintf("<p>page %d</p>", i)
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < n {
+				body += fmt.Sprintf(`<a href="/%d">%d</a>`, child, child)
+			}
+		}
+		pages[fmt.Sprintf("http://a/%d", i)] = &MemoryPage{Body: body}
+	}
+	pages["http://a/"] = pages["http://a/0"]
+	return pages
+}
+
+// number of results reported, saved in the checkpoint; Save runs while no callback does
+type countData struct {
+	count int
+}
+
+func (d *countData) Save(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%d", d.count)
+	return err
+}
+
+func (d *countData) Load(r io.Reader) error {
+	_, err := fmt.Fscan(r, &d.count)
+	return err
+}
+
+func TestCheckpointResume(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "crawl.checkpoint")
+	mutex := &sync.Mutex{}
+	newCrawler := func() *Crawler {
+		c := NewCrawler()
+		c.IgnoreRobots = true
+		c.HashLoopCheck = true
+		c.FrontierMemoryLimit = 5
+		c.Fetcher = NewMemoryFetcher(checkpointTestPages(300))
+		c.Checkpoint = checkpoint
+		c.CheckpointData = &countData{}
+		return c
+	}
+	reported := make(map[string]int)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newCrawler()
+	err := c.CrawlContext(ctx, "http://a/", func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		c.CheckpointData.(*countData).count += 1
+		reported[u.CrawlUrl] += 1
+		if u.Err != nil {
+			t.Errorf("%s: %s", u.CrawlUrl, u.Err)
+		}
+		if len(reported) == 50 {
+			cancel()
+		}
+	})
+	if err == nil || len(reported) >= 300 {
+		t.Errorf("crawl was not interrupted: %v, %d reported", err, len(reported))
+		t.FailNow()
+	}
+
+	c = newCrawler()
+	err = c.Resume(context.Background(), checkpoint, func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		c.CheckpointData.(*countData).count += 1
+		reported[u.CrawlUrl] += 1
+		if u.Err != nil {
+			t.Errorf("%s: %s", u.CrawlUrl, u.Err)
+		}
+	})
+	if err != nil {
+		t.Errorf("resume: %s", err)
+	}
+	if len(reported) != 300 || c.CheckpointData.(*countData).count != 300 {
+		t.Errorf("expected 300 pages, got %d, counted %d", len(reported), c.CheckpointData.(*countData).count)
+	}
+	for crawlUrl, count := range reported {
+		if count != 1 {
+			t.Errorf("%s reported %d times", crawlUrl, count)
+		}
+	}
+
+	// finished crawl leaves an empty frontier, resuming it again does nothing
+	err = newCrawler().Resume(context.Background(), checkpoint, func(u *FoundUrls) {
+		t.Errorf("%s reported after crawl finished", u.CrawlUrl)
+	})
+	if err != nil {
+		t.Errorf("resume finished crawl: %s", err)
+	}
+	if baseUrl, _ := CheckpointUrl(checkpoint); baseUrl != "http://a/" {
+		t.Errorf("CheckpointUrl: %s", baseUrl)
+	}
+}
+
+func TestCheckpointSeenStore(t *testing.T) {
+	disk, err := NewDiskSeenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	diskLoaded, err := NewDiskSeenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := []struct {
+		saved  SeenStore
+		loaded SeenStore
+	}{
+		{NewMemorySeenStore(), NewMemorySeenStore()},
+		{NewBloomSeenStore(64*1024, 1000), NewBloomSeenStore(8, 1)},
+		{disk, diskLoaded},
+	}
+	for i, s := range stores {
+		for j := 0; j < 1000; j++ {
+			_, _ = s.saved.Add(fmt.Sprintf("http://example.com/%d", j))
+		}
+		buf := new(bytes.Buffer)
+		err = s.saved.(CheckpointSeenStore).Save(buf)
+		if err == nil {
+			err = s.loaded.(CheckpointSeenStore).Load(bytes.NewReader(buf.Bytes()))
+		}
+		if err != nil {
+			t.Errorf("store %d: %s", i, err)
+			continue
+		}
+		for j := 0; j < 1000; j++ {
+			if added, _ := s.loaded.Add(fmt.Sprintf("http://example.com/%d", j)); added == true {
+				t.Errorf("store %d: URL %d not in loaded store", i, j)
+				break
+			}
+		}
+		if added, _ := s.loaded.Add("http://example.com/new"); added == false {
+			t.Errorf("store %d: new URL already in loaded store", i)
+		}
+		// saved by a different kind of store
+		if stores[(i+1)%len(stores)].loaded.(CheckpointSeenStore).Load(bytes.NewReader(buf.Bytes())) == nil {
+			t.Errorf("store %d: loaded into a different kind of store", i)
+		}
+		_ = s.saved.Close()
+	}
+	_ = diskLoaded.Close()
+}
+
+// cancels the crawl once cancelUrl was fetched
+type cancelFetcher struct {
+	fetcher   Fetcher
+	cancelUrl string
+	cancel    context.CancelFunc
+}
+
+func (f *cancelFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (*Response, error) {
+	resp, err := f.fetcher.Fetch(ctx, method, crawlUrl, header)
+	if crawlUrl == f.cancelUrl {
+		f.cancel()
+	}
+	return resp, err
+}
+
+func TestCheckpointFailureAfterCancel(t *testing.T) {
+	// a 404 coming back after the cancel is a real result: reported now, not saved to be fetched again
+	checkpoint := filepath.Join(t.TempDir(), "crawl.checkpoint")
+	pages := map[string]*MemoryPage{
+		"http://a/":  {Body: `<a href="/missing">missing</a><a href="/b">b</a>`},
+		"http://a/b": {Body: `<p>b</p>`},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Workers = 1
+	c.Checkpoint = checkpoint
+	c.Fetcher = &cancelFetcher{fetcher: NewMemoryFetcher(pages), cancelUrl: "http://a/missing", cancel: cancel}
+	var reported []string
+	_ = c.CrawlContext(ctx, "http://a/", func(u *FoundUrls) {
+		reported = append(reported, u.CrawlUrl)
+		if u.CrawlUrl == "http://a/missing" && errors.Is(u.Err, &HTTPStatusError{StatusCode: 404}) == false {
+			t.Errorf("missing: %v", u.Err)
+		}
+	})
+	if len(reported) != 2 || reported[1] != "http://a/missing" {
+		t.Errorf("reported before resume: %v", reported)
+	}
+
+	c = NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(pages)
+	reported = nil
+	err := c.Resume(context.Background(), checkpoint, func(u *FoundUrls) {
+		reported = append(reported, u.CrawlUrl)
+	})
+	if err != nil || len(reported) != 1 || reported[0] != "http://a/b" {
+		t.Errorf("reported after resume: %v %v", err, reported)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"golang.org/x/net/html"
 	"io"
+	"strings"
 )
 
 // simple wrapper, cause I cannot be bothered to keep typing this
@@ -15,22 +16,159 @@ func makeError(format string, a ...interface{}) error {
 // as the name suggests, extracts <a href, and returns links
 func extractHref(body io.Reader) []string {
 	var links []string
+	found, _ := extractLinks(body, []LinkSource{{Tag: "a", Attr: "href", Kind: LinkNavigation}})
+	for _, link := range found {
+		links = append(links, link.Url)
+	}
+	return links
+}
+
+// extracts links from the tag attributes listed in sources, labelling each with the source's Kind and the tag's rel values
+// srcset attributes yield one link per candidate, <meta content> is only used with http-equiv=refresh
+// baseHref is the href of the first <base> tag, which all relative links should be resolved against
+func extractLinks(body io.Reader, sources []LinkSource) (links []*Link, baseHref string) {
+	byTag := make(map[string][]LinkSource)
+	for _, source := range sources {
+		tag := strings.ToLower(source.Tag)
+		byTag[tag] = append(byTag[tag], source)
+	}
 	z := html.NewTokenizer(body)
 	for {
 		tt := z.Next()
 
 		switch tt {
 		case html.ErrorToken:
-			return links
-		case html.StartTagToken, html.EndTagToken:
+			return links, baseHref
+		case html.StartTagToken, html.SelfClosingTagToken:
 			token := z.Token()
-			if "a" == token.Data {
-				for _, attr := range token.Attr {
-					if attr.Key == "href" {
-						links = append(links, attr.Val)
+			if token.Data == "base" && baseHref == "" {
+				baseHref = strings.TrimSpace(tokenAttr(token, "href"))
+			}
+			tagSources := byTag[token.Data]
+			if len(tagSources) == 0 {
+				continue
+			}
+			if token.Data == "meta" && strings.EqualFold(tokenAttr(token, "http-equiv"), "refresh") == false {
+				continue
+			}
+			rel := strings.Fields(strings.ToLower(tokenAttr(token, "rel")))
+			for _, attr := range token.Attr {
+				for _, source := range tagSources {
+					if strings.EqualFold(attr.Key, source.Attr) == false {
+						continue
+					}
+					var vals []string
+					switch {
+					case attr.Key == "srcset":
+						vals = parseSrcset(attr.Val)
+					case token.Data == "meta":
+						vals = parseMetaRefresh(attr.Val)
+					default:
+						vals = []string{strings.TrimSpace(attr.Val)}
+					}
+					kind := source.Kind
+					if token.Data == "link" {
+						kind = linkRelKind(rel, kind)
+					}
+					for _, val := range vals {
+						if val != "" {
+							links = append(links, &Link{Url: val, Kind: kind, Rel: rel})
+						}
 					}
 				}
 			}
 		}
 	}
 }
+
+// kind of a <link> tag from its rel values: pages (next, prev, alternate, canonical) are navigation,
+// resources (stylesheet, icon, preload, ...) are assets, anything else keeps the kind of its LinkSource
+func linkRelKind(rel []string, kind LinkKind) LinkKind {
+	navigation := false
+	for _, r := range rel {
+		switch r {
+		case "stylesheet", "icon", "apple-touch-icon", "manifest", "preload", "modulepreload", "prefetch":
+			// rel="alternate stylesheet" is still a stylesheet
+			return LinkAsset
+		case "next", "prev", "previous", "alternate", "canonical":
+			navigation = true
+		}
+	}
+	if navigation == true {
+		return LinkNavigation
+	}
+	return kind
+}
+
+// returns value of attribute key of token, or "" if not set
+func tokenAttr(token html.Token, key string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// splits srcset into candidate URLs: "a.png 1x, b.png 2x" -> [a.png b.png]
+// follows the HTML srcset parsing rules, so commas inside a URL (w_100,h_100/a.jpg) do not split it, data: candidates are left out
+func parseSrcset(srcset string) (urls []string) {
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+	i := 0
+	for i < len(srcset) {
+		// whitespace and commas before the candidate
+		for i < len(srcset) && (isSpace(srcset[i]) == true || srcset[i] == ',') {
+			i++
+		}
+		start := i
+		for i < len(srcset) && isSpace(srcset[i]) == false {
+			i++
+		}
+		candidate := srcset[start:i]
+		descriptor := true
+		if strings.HasSuffix(candidate, ",") {
+			// "a.png, b.png": no descriptor, next candidate follows the comma
+			candidate = strings.TrimSuffix(candidate, ",")
+			descriptor = false
+		}
+		if descriptor == true {
+			// descriptor runs up to the next comma outside parentheses
+			inParens := false
+			for i < len(srcset) && (srcset[i] != ',' || inParens == true) {
+				if srcset[i] == '(' {
+					inParens = true
+				} else if srcset[i] == ')' {
+					inParens = false
+				}
+				i++
+			}
+		}
+		if candidate != "" && strings.HasPrefix(strings.ToLower(candidate), "data:") == false {
+			urls = append(urls, candidate)
+		}
+	}
+	return
+}
+
+// extracts target from meta refresh content: "5; url=/foo" -> [/foo], whitespace around "=" is allowed: "0; URL = /foo"
+func parseMetaRefresh(content string) []string {
+	lower := strings.ToLower(content)
+	for i := strings.Index(lower, "url"); i >= 0; i = nextIndex(lower, "url", i) {
+		rest := strings.TrimLeft(content[i+3:], " \t\n\r\f")
+		if strings.HasPrefix(rest, "=") {
+			return []string{strings.Trim(strings.TrimSpace(rest[1:]), `'"`)}
+		}
+	}
+	return nil
+}
+
+// index of substr in s after position i, or -1
+func nextIndex(s string, substr string, i int) int {
+	j := strings.Index(s[i+1:], substr)
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
@@ -21,3 +21,79 @@ func TestExtractHref(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestExtractLinks(t *testing.T) {
+	r := strings.NewReader(`<html><head>
+<meta http-equiv="Refresh" content="5; URL='/next'">
+<meta name="description" content="url=/not-a-link">
+<link rel="stylesheet" href="/style.css">
+<link rel="next" href="/page/2">
+<link rel="alternate stylesheet" href="/dark.css">
+<link rel="alternate" hreflang="de" href="/de/">
+<base href="/sub/">
+</head><body>
+<a href="page" rel="NoFollow UGC">x</a>
+<img src="/a.png" srcset="/a-1x.png 1x, /a-2x.png 2x"/>
+<form action="/search"></form>
+</body></html>`)
+	links, baseHref := extractLinks(r, DefaultLinkSources)
+	expected := []Link{
+		{Url: "/next", Kind: LinkNavigation},
+		{Url: "/style.css", Kind: LinkAsset},
+		{Url: "/page/2", Kind: LinkNavigation},
+		{Url: "/dark.css", Kind: LinkAsset},
+		{Url: "/de/", Kind: LinkNavigation},
+		{Url: "page", Kind: LinkNavigation},
+		{Url: "/a.png", Kind: LinkAsset},
+		{Url: "/a-1x.png", Kind: LinkAsset},
+		{Url: "/a-2x.png", Kind: LinkAsset},
+		{Url: "/search", Kind: LinkNavigation},
+	}
+	if len(links) != len(expected) || baseHref != "/sub/" {
+		t.Errorf("%d links, base %s", len(links), baseHref)
+		t.FailNow()
+	}
+	for i := range expected {
+		if links[i].Url != expected[i].Url || links[i].Kind != expected[i].Kind {
+			t.Errorf("%d: %v", i, *links[i])
+		}
+	}
+	if links[5].HasRel("nofollow") == false || links[5].HasRel("ugc") == false || links[1].HasRel("stylesheet") == false || links[0].HasRel("nofollow") == true {
+		t.Errorf("rel: %v %v", links[1].Rel, links[5].Rel)
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	checks := map[string][]string{
+		"/a-1x.png 1x, /a-2x.png 2x": {"/a-1x.png", "/a-2x.png"},
+		"/a.png, /b.png":             {"/a.png", "/b.png"},
+		"/a.png 1x,/b.png 2x":        {"/a.png", "/b.png"},
+		"https://res.cloudinary.com/x/w_100,h_100/a.jpg 100w, b.jpg 2x": {"https://res.cloudinary.com/x/w_100,h_100/a.jpg", "b.jpg"},
+		"data:image/gif;base64,R0lGODlhAQABAAAAACw= 1x, /b.png 2x":      {"/b.png"},
+		"  /a.png (max-width: 10px, 1x) , /b.png":                       {"/a.png", "/b.png"},
+		"": nil,
+	}
+	for srcset, expected := range checks {
+		urls := parseSrcset(srcset)
+		if strings.Join(urls, " ") != strings.Join(expected, " ") {
+			t.Errorf("%q: expected %q got %q", srcset, expected, urls)
+		}
+	}
+}
+
+func TestParseMetaRefresh(t *testing.T) {
+	checks := map[string]string{
+		"5; url=/next":         "/next",
+		"0; URL = /x":          "/x",
+		"0;URL='/quoted'":      "/quoted",
+		"0; url =\t\"/tab\"":   "/tab",
+		"10":                   "",
+		"0; curly=/no; url=/y": "/y",
+	}
+	for content, expected := range checks {
+		urls := parseMetaRefresh(content)
+		if (expected == "" && len(urls) != 0) || (expected != "" && (len(urls) != 1 || urls[0] != expected)) {
+			t.Errorf("%q: expected %q got %q", content, expected, urls)
+		}
+	}
+}
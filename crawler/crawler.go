@@ -1,20 +1,53 @@
 package crawler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"time"
 )
 
 // external Crawler struct with config parameters
 type Crawler struct {
-	Timeout             time.Duration
-	MaxDepth            int
-	Workers             int
-	Auth                *CrawlerAuth
-	HashLoopCheck       bool
-	FollowExternal      bool
-	UserAgent           *string
-	Retries             int
-	SleepBetweenRetries time.Duration
+	Timeout               time.Duration
+	Transport             Transport
+	RoundTripper          http.RoundTripper
+	Fetcher               Fetcher
+	SiteRoot              string
+	Hooks                 Hooks
+	SerializeCallbacks    bool
+	ResultsBuffer         int
+	MaxDepth              int
+	Workers               int
+	Auth                  *CrawlerAuth
+	HashLoopCheck         bool
+	FollowExternal        bool
+	UserAgent             *string
+	Retries               int
+	SleepBetweenRetries   time.Duration
+	FrontierMemoryLimit   int
+	SeenStore             SeenStore
+	Redirects             RedirectPolicy
+	MaxRedirects          int
+	IgnoreRobots          bool
+	HostLimit             HostLimit
+	HostLimits            map[string]HostLimit
+	CheckExternal         bool
+	LinkSources           []LinkSource
+	Nofollow              NofollowPolicy
+	Normalizer            *Normalizer
+	Scope                 *Scope
+	Rules                 []*UrlRule
+	Traps                 TrapLimits
+	NearDuplicates        bool
+	NearDuplicateDistance int
+	ReportHeaders         []string
+	RetryPolicy           RetryPolicy
+	Checkpoint            string
+	CheckpointInterval    time.Duration
+	CheckpointData        CheckpointData
 }
 
 // auth part of crawler config struct
@@ -23,18 +56,179 @@ type CrawlerAuth struct {
 	Password string
 }
 
+// how the crawler handles 3xx responses
+type RedirectPolicy int
+
+const (
+	// follow redirects up to MaxRedirects hops, as long as the target is in scope
+	RedirectFollow RedirectPolicy = iota
+	// do not follow, report the hop and the target as a found link
+	RedirectRecord
+	// do not follow, report the hop and an error
+	RedirectRefuse
+)
+
+// single redirect hop: Url responded with StatusCode, pointing to Location
+type Redirect struct {
+	StatusCode int
+	Url        string
+	Location   string
+}
+
+// kind of link: navigation links are crawled, asset links are only checked for existence
+type LinkKind string
+
+const (
+	LinkNavigation LinkKind = "navigation"
+	LinkAsset      LinkKind = "asset"
+)
+
+// single link found on a crawled page
+// Url is absolute and normalized, Raw is the link as written in the page
+// Rel holds lower-cased values of the tag's rel attribute (nofollow, ugc, sponsored, canonical, alternate, ...)
+// InScope and ScopeReason hold the Crawler.Scope decision, ScopeReason is one of Scope* reason constants
+// Filtered links were excluded by Crawler.Rules and are not fetched, FilterRule is the excluding rule's pattern
+// Trap is set to one of Trap* constants when the link was caught by Crawler.Traps, such links are not fetched either
+type Link struct {
+	Url         string
+	Raw         string `json:",omitempty"`
+	Kind        LinkKind
+	Rel         []string `json:",omitempty"`
+	InScope     bool
+	ScopeReason string
+	Filtered    bool   `json:",omitempty"`
+	FilterRule  string `json:",omitempty"`
+	Trap        string `json:",omitempty"`
+}
+
+// does the link have rel value
+func (l *Link) HasRel(rel string) bool {
+	for _, r := range l.Rel {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// how the crawler handles rel=nofollow links
+type NofollowPolicy int
+
+const (
+	// crawl them like any other link
+	NofollowFollow NofollowPolicy = iota
+	// drop them, they are neither reported nor crawled
+	NofollowSkip
+	// report them in FoundUrls.NofollowLinks instead of FoundUrls/Links, do not crawl
+	NofollowReport
+)
+
+// extract links from attribute Attr of tag Tag, labelling them with Kind
+type LinkSource struct {
+	Tag  string
+	Attr string
+	Kind LinkKind
+}
+
+// default Crawler.LinkSources
+// <link> kind depends on its rel: next, prev, alternate and canonical are navigation, stylesheet, icon, preload and others assets
+var DefaultLinkSources = []LinkSource{
+	{Tag: "a", Attr: "href", Kind: LinkNavigation},
+	{Tag: "area", Attr: "href", Kind: LinkNavigation},
+	{Tag: "iframe", Attr: "src", Kind: LinkNavigation},
+	{Tag: "frame", Attr: "src", Kind: LinkNavigation},
+	{Tag: "form", Attr: "action", Kind: LinkNavigation},
+	{Tag: "meta", Attr: "content", Kind: LinkNavigation},
+	{Tag: "link", Attr: "href", Kind: LinkAsset},
+	{Tag: "script", Attr: "src", Kind: LinkAsset},
+	{Tag: "img", Attr: "src", Kind: LinkAsset},
+	{Tag: "img", Attr: "srcset", Kind: LinkAsset},
+	{Tag: "source", Attr: "src", Kind: LinkAsset},
+	{Tag: "source", Attr: "srcset", Kind: LinkAsset},
+	{Tag: "video", Attr: "src", Kind: LinkAsset},
+	{Tag: "video", Attr: "poster", Kind: LinkAsset},
+	{Tag: "audio", Attr: "src", Kind: LinkAsset},
+	{Tag: "embed", Attr: "src", Kind: LinkAsset},
+	{Tag: "object", Attr: "data", Kind: LinkAsset},
+}
+
+// values of FoundUrls.Skipped, reason why a URL was not fetched
+const (
+	// disallowed by robots.txt
+	SkippedRobots = "robots.txt"
+	// fetched, but not text/html, so the body was not read or parsed for links
+	SkippedNotHtml = "not-html"
+)
+
 // struct returned to callback func for each url crawled with urls found
 type FoundUrls struct {
-	CrawlUrl  string
-	FoundUrls []*string
-	Err       error
-	Depth     int
+	CrawlUrl        string
+	FoundUrls       []*string
+	Err             error
+	Depth           int
+	Redirects       []*Redirect
+	Skipped         string
+	Sitemaps        []*string
+	FinalUrl        string
+	StatusCode      int
+	ContentType     string
+	LastModified    time.Time
+	CheckOnly       bool
+	Links           []*Link
+	NofollowLinks   []*Link
+	SimHash         uint64
+	NearDuplicateOf string
+	Referrer        string
+	ContentLength   int64
+	BytesRead       int64
+	Headers         http.Header
+	Timings         *Timings
+	LinkErrors      []error
+	Attempts        int
+}
+
+// with an HTTPStatusError, sets StatusCode and FinalUrl from it, the response itself is not kept
+func (u *FoundUrls) setStatusFromError() {
+	var statusErr *HTTPStatusError
+	if errors.As(u.Err, &statusErr) {
+		u.StatusCode = statusErr.StatusCode
+		u.FinalUrl = statusErr.Url
+	}
+}
+
+// adds link to both FoundUrls and Links
+func (u *FoundUrls) addLink(link *Link) {
+	u.FoundUrls = append(u.FoundUrls, &link.Url)
+	u.Links = append(u.Links, link)
+}
+
+// returned by CrawlContext when the context was cancelled or its deadline passed before the crawl finished
+type IncompleteCrawlError struct {
+	Err        error
+	Crawled    int
+	NotCrawled int
+}
+
+func (e *IncompleteCrawlError) Error() string {
+	return fmt.Sprintf("crawl incomplete: %s (crawled %d URLs, %d queued URLs not crawled)", e.Err, e.Crawled, e.NotCrawled)
+}
+
+// allows errors.Is(err, context.Canceled) and friends
+func (e *IncompleteCrawlError) Unwrap() error {
+	return e.Err
 }
 
 // creates a new crawler object
 func NewCrawler() (crawler *Crawler) {
 	crawler = new(Crawler)
 	crawler.Timeout = 60 * time.Second
+	crawler.Transport = DefaultTransport
+	crawler.RoundTripper = nil
+	crawler.Fetcher = nil
+	crawler.SiteRoot = ""
+	crawler.Hooks = Hooks{}
+	crawler.SerializeCallbacks = false
+	crawler.ResultsBuffer = 0
 	crawler.MaxDepth = -1
 	crawler.Auth = nil
 	crawler.Workers = 10
@@ -43,17 +237,67 @@ func NewCrawler() (crawler *Crawler) {
 	crawler.UserAgent = nil
 	crawler.Retries = 0
 	crawler.SleepBetweenRetries = 0
+	crawler.FrontierMemoryLimit = 100000
+	crawler.SeenStore = nil
+	crawler.Redirects = RedirectFollow
+	crawler.MaxRedirects = 10
+	crawler.IgnoreRobots = false
+	crawler.HostLimit = HostLimit{RequestsPerSecond: 0, Burst: 1, MaxConnections: 0}
+	crawler.HostLimits = nil
+	crawler.CheckExternal = false
+	crawler.LinkSources = DefaultLinkSources
+	crawler.Nofollow = NofollowFollow
+	crawler.Normalizer = NewNormalizer()
+	crawler.Scope = NewScope()
+	crawler.Rules = nil
+	crawler.Traps = DefaultTrapLimits
+	crawler.NearDuplicates = false
+	crawler.NearDuplicateDistance = 3
+	crawler.ReportHeaders = DefaultReportHeaders
+	crawler.RetryPolicy = DefaultRetryPolicy
+	crawler.Checkpoint = ""
+	crawler.CheckpointInterval = time.Minute
+	crawler.CheckpointData = nil
 	return
 }
 
-// run crawler: creates new crawl worker and runs the first job
+// run crawler: creates new crawl worker, queues the first job and starts the worker pool
+// callbackFunc is called from up to Crawler.Workers goroutines at once, unless Crawler.SerializeCallbacks is set
 func (c *Crawler) Crawl(baseUrl string, callbackFunc func(*FoundUrls)) {
-	w := newCrawlWorker(c, baseUrl, callbackFunc)
-	c.crawlInternal(w)
+	_ = c.CrawlContext(context.Background(), baseUrl, callbackFunc)
+}
+
+// run crawler until done or until ctx is cancelled
+// on cancel no new requests are started, requests in flight finish and are reported, and *IncompleteCrawlError is returned
+// jobs cut short before sending their request are not reported, with Crawler.Checkpoint they are saved in the checkpoint, see Resume
+func (c *Crawler) CrawlContext(ctx context.Context, baseUrl string, callbackFunc func(*FoundUrls)) error {
+	w := newCrawlWorker(ctx, c, baseUrl, callbackFunc)
+	if _, ok := w.seen.(CheckpointSeenStore); c.Checkpoint != "" && ok == false {
+		return makeError("checkpoint: SeenStore does not implement CheckpointSeenStore")
+	}
+	return c.crawlInternal(w)
+}
+
+// returns the URL a crawl of baseUrl starts from, as reported in FoundUrls.CrawlUrl
+// file:// URL for a local path, normalized with Crawler.Normalizer
+func (c *Crawler) StartUrl(baseUrl string) string {
+	startUrl, _ := c.startUrl(baseUrl, c.SiteRoot)
+	return startUrl
+}
+
+// same as StartUrl, with siteRoot instead of Crawler.SiteRoot, also returns site root of a local crawl
+func (c *Crawler) startUrl(baseUrl string, siteRoot string) (startUrl string, root *url.URL) {
+	startUrl, root, _ = localSeed(baseUrl, siteRoot)
+	if c.Normalizer != nil {
+		if normalized, err := c.Normalizer.Normalize(startUrl); err == nil {
+			startUrl = normalized
+		}
+	}
+	return
 }
 
-func (c *Crawler) crawlInternal(w crawlWorkerInterface) {
-	w.addWorker()
-	w.crawl("", 0)
-	w.waitForWorkers()
+func (c *Crawler) crawlInternal(w crawlWorkerInterface) error {
+	w.enqueue("", 0, "")
+	w.startWorkers()
+	return w.waitForWorkers()
 }
@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// every URL found is crawled or counted as not crawled, pages of resultsTestPages(n) are n+1
+func testIncompleteCrawl(t *testing.T, err error, ctxErr error, reported int, pages int) {
+	var incomplete *IncompleteCrawlError
+	if errors.As(err, &incomplete) == false {
+		t.Errorf("expected IncompleteCrawlError, got %v", err)
+		t.FailNow()
+	}
+	if errors.Is(err, ctxErr) == false {
+		t.Errorf("expected %s, got %s", ctxErr, err)
+	}
+	if incomplete.Crawled != reported {
+		t.Errorf("Crawled %d, reported %d", incomplete.Crawled, reported)
+	}
+	if incomplete.Crawled+incomplete.NotCrawled != pages {
+		t.Errorf("Crawled %d + NotCrawled %d, expected %d pages", incomplete.Crawled, incomplete.NotCrawled, pages)
+	}
+}
+
+func TestCrawlContextCancel(t *testing.T) {
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Workers = 2
+	c.Fetcher = NewMemoryFetcher(resultsTestPages(30))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mutex := &sync.Mutex{}
+	reported := 0
+	err := c.CrawlContext(ctx, "http://a/", func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported += 1
+		if u.Err != nil {
+			t.Errorf("%s: %s", u.CrawlUrl, u.Err)
+		}
+		if reported == 5 {
+			cancel()
+		}
+	})
+	testIncompleteCrawl(t, err, context.Canceled, reported, 31)
+}
+
+// cancels the crawl once workers requests are in flight at the same time, then lets them finish
+type inFlightFetcher struct {
+	fetcher  Fetcher
+	workers  int
+	cancel   context.CancelFunc
+	mutex    sync.Mutex
+	inFlight int
+	all      chan struct{}
+}
+
+func (f *inFlightFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (*Response, error) {
+	if crawlUrl != "http://a/" {
+		f.mutex.Lock()
+		f.inFlight += 1
+		if f.inFlight == f.workers {
+			f.cancel()
+			close(f.all)
+		}
+		f.mutex.Unlock()
+		<-f.all
+	}
+	return f.fetcher.Fetch(ctx, method, crawlUrl, header)
+}
+
+func TestCrawlContextCancelInFlight(t *testing.T) {
+	// requests sent before the cancel finish and are reported, without errors
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Workers = 4
+	c.Fetcher = &inFlightFetcher{fetcher: NewMemoryFetcher(resultsTestPages(30)), workers: 4, cancel: cancel, all: make(chan struct{})}
+	mutex := &sync.Mutex{}
+	reported := 0
+	err := c.CrawlContext(ctx, "http://a/", func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported += 1
+		if u.Err != nil || u.StatusCode != 200 {
+			t.Errorf("%s: %d %v", u.CrawlUrl, u.StatusCode, u.Err)
+		}
+	})
+	if reported != 5 {
+		t.Errorf("expected the seed and 4 requests in flight reported, got %d", reported)
+	}
+	testIncompleteCrawl(t, err, context.Canceled, reported, 31)
+}
+
+func TestCrawlContextDeadline(t *testing.T) {
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Workers = 2
+	c.Fetcher = NewMemoryFetcher(resultsTestPages(30))
+	c.Hooks.OnResponse(func(u *FoundUrls, resp *Response) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	mutex := &sync.Mutex{}
+	reported := 0
+	err := c.CrawlContext(ctx, "http://a/", func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported += 1
+		if u.Err != nil {
+			t.Errorf("%s: %s", u.CrawlUrl, u.Err)
+		}
+	})
+	testIncompleteCrawl(t, err, context.DeadlineExceeded, reported, 31)
+
+	// finished crawl is not incomplete
+	err = c.CrawlContext(context.Background(), "http://a/", func(u *FoundUrls) {})
+	if err != nil {
+		t.Errorf("finished crawl: %s", err)
+	}
+}
@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// server responded with a status code other than 2xx or a followable 3xx
+// errors.Is(err, &HTTPStatusError{StatusCode: 404}) matches a 404 from any URL, StatusCode 0 matches any status
+type HTTPStatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("statusCode: %d", e.StatusCode)
+}
+
+func (e *HTTPStatusError) Is(target error) bool {
+	t, ok := target.(*HTTPStatusError)
+	return ok == true && (t.StatusCode == 0 || t.StatusCode == e.StatusCode) && (t.Url == "" || t.Url == e.Url)
+}
+
+// request could not be made or the response could not be read, Op is the step which failed
+type FetchError struct {
+	Url string
+	Op  string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// request timed out: Crawler.Timeout, one of Crawler.Transport timeouts, or a network timeout
+func (e *FetchError) Timeout() bool {
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// failure which may go away when retried: timeouts, refused or reset connections, temporary DNS failures, connection closed early
+// a cancelled crawl is never temporary
+func (e *FetchError) Temporary() bool {
+	if errors.Is(e.Err, context.Canceled) {
+		return false
+	}
+	if e.Timeout() == true {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(e.Err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	return errors.Is(e.Err, syscall.ECONNREFUSED) || errors.Is(e.Err, syscall.ECONNRESET) || errors.Is(e.Err, io.ErrUnexpectedEOF) || errors.Is(e.Err, io.EOF)
+}
+
+// link found on Base could not be parsed or normalized
+type ParseLinkError struct {
+	Base string
+	Link string
+	Err  error
+}
+
+func (e *ParseLinkError) Error() string {
+	return fmt.Sprintf("url.Parse.Parse(%s): %s", e.Link, e.Err)
+}
+
+func (e *ParseLinkError) Unwrap() error {
+	return e.Err
+}
+
+// with Crawler.HashLoopCheck, body of Url is the same as of DuplicateOf, crawled earlier
+type HashLoopError struct {
+	Url         string
+	DuplicateOf string
+}
+
+func (e *HashLoopError) Error() string {
+	return fmt.Sprintf("HashLoopCheck: %s", e.DuplicateOf)
+}
+
+// Url is disallowed by robots.txt
+type RobotsDisallowedError struct {
+	Url string
+}
+
+func (e *RobotsDisallowedError) Error() string {
+	return fmt.Sprintf("disallowed by robots.txt: %s", e.Url)
+}
+
+// Url is out of Crawler.Scope, Reason is one of Scope* reason constants
+type ScopeError struct {
+	Url    string
+	Reason string
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("out of scope (%s): %s", e.Reason, e.Url)
+}
+
+// hook in Crawler.Hooks panicked while handling Url, Hook is the hook kind, e.g. OnResponse
+type HookPanicError struct {
+	Hook  string
+	Url   string
+	Value interface{}
+	Stack []byte
+}
+
+func (e *HookPanicError) Error() string {
+	return fmt.Sprintf("%s panic: %v", e.Hook, e.Value)
+}
+
+// values of RedirectError.Reason
+const (
+	RedirectReasonRefused = "refused"
+	RedirectReasonTooMany = "too-many"
+	RedirectReasonLoop    = "loop"
+)
+
+// redirect of Url to Location was not followed, Reason is one of RedirectReason* constants
+// Hops is the number of redirects seen so far, including this one, StatusCode is the status of the last one
+type RedirectError struct {
+	Url        string
+	Location   string
+	StatusCode int
+	Reason     string
+	Hops       int
+}
+
+func (e *RedirectError) Error() string {
+	switch e.Reason {
+	case RedirectReasonRefused:
+		return fmt.Sprintf("redirect refused: %d to %s", e.StatusCode, e.Location)
+	case RedirectReasonLoop:
+		return fmt.Sprintf("redirect loop: %s", e.Location)
+	}
+	return fmt.Sprintf("too many redirects: %d", e.Hops)
+}
+
+// Crawler.SeenStore failed to record Url, the URL is not crawled
+type SeenStoreError struct {
+	Url string
+	Err error
+}
+
+func (e *SeenStoreError) Error() string {
+	return fmt.Sprintf("SeenStore.Add: %s", e.Err)
+}
+
+func (e *SeenStoreError) Unwrap() error {
+	return e.Err
+}
+
+// Crawler.Fetcher returned neither a response nor an error, reported wrapped in a FetchError
+var ErrNoResponse = errors.New("Fetcher returned no response")
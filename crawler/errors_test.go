@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+)
+
+func TestErrorTypes(t *testing.T) {
+	var err error = fmt.Errorf("doHttpRequest: %w", &HTTPStatusError{Url: "http://a/", StatusCode: 404})
+	if errors.Is(err, &HTTPStatusError{StatusCode: 404}) == false || errors.Is(err, &HTTPStatusError{}) == false {
+		t.Errorf("Is 404: %s", err)
+	}
+	if errors.Is(err, &HTTPStatusError{StatusCode: 500}) == true || errors.Is(err, &HTTPStatusError{Url: "http://b/"}) == true {
+		t.Errorf("Is 500: %s", err)
+	}
+
+	timeout := &FetchError{Url: "http://a/", Op: "http.Do", Err: &net.OpError{Op: "dial", Err: context.DeadlineExceeded}}
+	refused := &FetchError{Url: "http://a/", Op: "http.Do", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}
+	cancelled := &FetchError{Url: "http://a/", Op: "hostLimiter", Err: context.Canceled}
+	dns := &FetchError{Url: "http://a/", Op: "http.Do", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}
+	if timeout.Timeout() == false || timeout.Temporary() == false {
+		t.Errorf("timeout: %v %v", timeout.Timeout(), timeout.Temporary())
+	}
+	if refused.Timeout() == true || refused.Temporary() == false {
+		t.Errorf("refused: %v %v", refused.Timeout(), refused.Temporary())
+	}
+	if cancelled.Temporary() == true || errors.Is(cancelled, context.Canceled) == false {
+		t.Errorf("cancelled: %v", cancelled.Temporary())
+	}
+	if dns.Temporary() == true {
+		t.Errorf("dns: expected permanent")
+	}
+}
+
+func TestCrawlWorkErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<a href='http://[::1'>bad</a><a href='/ok'>ok</a><a href='/missing'>missing</a>"))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	w := newCrawlWorker(context.Background(), c, s.URL+"/", func(*FoundUrls) {})
+
+	u := w.crawlWork(s.URL+"/", 0, "")
+	var parseErr *ParseLinkError
+	if u.Err != nil || len(u.Links) != 2 || len(u.LinkErrors) != 1 || errors.As(u.LinkErrors[0], &parseErr) == false || parseErr.Link != "http://[::1" {
+		t.Errorf("page: %v %v", u.Err, u.LinkErrors)
+	}
+	u = w.crawlWork(s.URL+"/missing", 1, s.URL+"/")
+	var statusErr *HTTPStatusError
+	if errors.As(u.Err, &statusErr) == false || statusErr.StatusCode != 404 || u.StatusCode != 404 || u.FinalUrl != s.URL+"/missing" {
+		t.Errorf("missing: %v %d", u.Err, u.StatusCode)
+	}
+}
+
+// SeenStore which always fails
+type failingSeenStore struct{}
+
+func (s failingSeenStore) Add(url string) (bool, error) {
+	return false, errors.New("disk full")
+}
+
+func (s failingSeenStore) Close() error {
+	return nil
+}
+
+// Fetcher which returns neither a response nor an error
+type nilFetcher struct{}
+
+func (f nilFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (*Response, error) {
+	return nil, nil
+}
+
+func TestCrawlWorkErrorTypes(t *testing.T) {
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Redirects = RedirectRefuse
+	c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{"http://a/": {StatusCode: 302, Header: http.Header{"Location": {"/b"}}}})
+	u := newCrawlWorker(context.Background(), c, "http://a/", func(*FoundUrls) {}).crawlWork("http://a/", 0, "")
+	var redirectErr *RedirectError
+	if errors.As(u.Err, &redirectErr) == false || redirectErr.Reason != RedirectReasonRefused || redirectErr.Url != "http://a/" || redirectErr.Location != "http://a/b" || redirectErr.Hops != 1 {
+		t.Errorf("redirect: %v", u.Err)
+	}
+
+	c.Fetcher = nilFetcher{}
+	u = newCrawlWorker(context.Background(), c, "http://a/", func(*FoundUrls) {}).crawlWork("http://a/", 0, "")
+	var fetchErr *FetchError
+	if errors.As(u.Err, &fetchErr) == false || fetchErr.Op != "Fetch" || errors.Is(u.Err, ErrNoResponse) == false {
+		t.Errorf("no response: %v", u.Err)
+	}
+
+	c.SeenStore = failingSeenStore{}
+	var reported []*FoundUrls
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		reported = append(reported, u)
+	})
+	var seenErr *SeenStoreError
+	if len(reported) != 1 || errors.As(reported[0].Err, &seenErr) == false || seenErr.Url != "http://a/" || seenErr.Err.Error() != "disk full" {
+		t.Errorf("seen store: %v", reported)
+	}
+}
+
+func TestErrorText(t *testing.T) {
+	// error texts are the same as before the typed errors
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{"http://a/": {Body: `<a href="/missing">x</a>`}})
+	c.SerializeCallbacks = true
+	reported := make(map[string]*FoundUrls)
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		reported[u.CrawlUrl] = u
+	})
+	if u := reported["http://a/missing"]; u == nil || u.Err == nil || u.Err.Error() != "doHttpRequest: statusCode: 404" {
+		t.Errorf("404: %v", u)
+	}
+	parseErr := &ParseLinkError{Base: "http://a/", Link: "%", Err: errors.New("invalid URL escape")}
+	if parseErr.Error() != "url.Parse.Parse(%): invalid URL escape" {
+		t.Errorf("parse: %s", parseErr)
+	}
+}
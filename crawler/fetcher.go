@@ -0,0 +1,240 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// fetches a single URL, see Crawler.Fetcher
+// redirects should not be followed, 3xx responses with a Location header are handled by the crawler, hop by hop
+// a response with any status code is not an error, err is only for failures to get a response at all
+// the crawler closes resp.Body
+type Fetcher interface {
+	Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (resp *Response, err error)
+}
+
+// response returned by a Fetcher
+type Response struct {
+	// URL the response came from, the requested URL unless the Fetcher followed redirects itself
+	Url string
+
+	StatusCode int
+	Header     http.Header
+
+	// -1 if unknown
+	ContentLength int64
+
+	// never nil, empty for HEAD requests
+	Body io.ReadCloser
+
+	// set by the crawler, times the request
+	timer *requestTimer
+}
+
+// fetches over net/http using client
+type httpFetcher struct {
+	client *http.Client
+}
+
+// creates Fetcher making requests with client, nil client means a client which does not follow redirects
+// if the client follows redirects, Response.Url is the URL of the last one
+// Crawler.Fetcher == nil uses a http fetcher with a client built from Crawler.Transport or Crawler.RoundTripper
+func NewHTTPFetcher(client *http.Client) Fetcher {
+	if client == nil {
+		client = &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	}
+	return &httpFetcher{client: client}
+}
+
+func (f *httpFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (resp *Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, crawlUrl, nil)
+	if err != nil {
+		err = &FetchError{Url: crawlUrl, Op: "http.NewRequest", Err: err}
+		return
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	r, err := f.client.Do(req)
+	if err != nil {
+		err = &FetchError{Url: crawlUrl, Op: "http.Do", Err: err}
+		return
+	}
+	resp = &Response{Url: crawlUrl, StatusCode: r.StatusCode, Header: r.Header, ContentLength: r.ContentLength, Body: r.Body}
+	if r.Request != req {
+		// client followed redirects
+		resp.Url = r.Request.URL.String()
+	}
+	return
+}
+
+// serves URLs under baseUrl from fsys, for crawling a static site without a web server
+type fsFetcher struct {
+	fsys fs.FS
+	base *url.URL
+}
+
+// creates Fetcher serving URLs under baseUrl from fsys, other URLs fail with an error
+// a path ending with / is served from index.html in that directory, a directory without the trailing / redirects to it
+// Content-Type is set from the file extension, or sniffed from the content if the extension is unknown
+// missing files are 404
+func NewFSFetcher(fsys fs.FS, baseUrl string) (Fetcher, error) {
+	base, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(base.Path, "/") == false {
+		base.Path += "/"
+	}
+	return &fsFetcher{fsys: fsys, base: base}, nil
+}
+
+// creates Fetcher serving URLs under baseUrl from files in dir, see NewFSFetcher
+func NewDirFetcher(dir string, baseUrl string) (Fetcher, error) {
+	return NewFSFetcher(os.DirFS(dir), baseUrl)
+}
+
+// name of the file in fsys for crawlUrl, ok == false if the URL is not under base
+// the base directory itself without the trailing slash is "."
+func (f *fsFetcher) name(crawlUrl string) (name string, ok bool) {
+	u, err := url.Parse(crawlUrl)
+	if err != nil || u.Scheme != f.base.Scheme || u.Host != f.base.Host {
+		return "", false
+	}
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	if p+"/" == f.base.Path {
+		return ".", true
+	}
+	if strings.HasPrefix(p, f.base.Path) == false {
+		return "", false
+	}
+	name = strings.TrimPrefix(p, f.base.Path)
+	if strings.HasSuffix(p, "/") == true || name == "" {
+		name += "index.html"
+	}
+	name = path.Clean(name)
+	return name, fs.ValidPath(name)
+}
+
+func (f *fsFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (resp *Response, err error) {
+	if err = ctx.Err(); err != nil {
+		err = &FetchError{Url: crawlUrl, Op: "fs", Err: err}
+		return
+	}
+	name, ok := f.name(crawlUrl)
+	if ok == false {
+		err = &FetchError{Url: crawlUrl, Op: "fs", Err: makeError("not under %s", f.base)}
+		return
+	}
+	resp = &Response{Url: crawlUrl, Header: make(http.Header), ContentLength: -1, Body: http.NoBody}
+	info, errS := fs.Stat(f.fsys, name)
+	if errS == nil && info.IsDir() == true {
+		// directory URL without the trailing slash, same as a web server would do
+		location, _ := url.Parse(crawlUrl)
+		location.Path += "/"
+		location.RawPath = ""
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", location.String())
+		return
+	}
+	if errS != nil {
+		resp.StatusCode = http.StatusNotFound
+		return
+	}
+	body, err := fs.ReadFile(f.fsys, name)
+	if err != nil {
+		resp = nil
+		err = &FetchError{Url: crawlUrl, Op: "fs.ReadFile", Err: err}
+		return
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Header.Set("Content-Type", contentType(name, body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	resp.ContentLength = int64(len(body))
+	if method != "HEAD" {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return
+}
+
+// Content-Type from the extension of name, sniffed from body if the extension is unknown
+func contentType(name string, body []byte) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(body)
+}
+
+// single page served by NewMemoryFetcher
+// StatusCode 0 means 200, Content-Type is sniffed from Body if not in Header
+type MemoryPage struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// serves pages from a map, for tests
+type memoryFetcher struct {
+	pages map[string]*MemoryPage
+}
+
+// creates Fetcher serving pages keyed by URL, URLs not in the map are 404
+// the map must not be modified while crawling
+func NewMemoryFetcher(pages map[string]*MemoryPage) Fetcher {
+	return &memoryFetcher{pages: pages}
+}
+
+func (f *memoryFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (resp *Response, err error) {
+	if err = ctx.Err(); err != nil {
+		err = &FetchError{Url: crawlUrl, Op: "memory", Err: err}
+		return
+	}
+	resp = &Response{Url: crawlUrl, StatusCode: http.StatusNotFound, Header: make(http.Header), ContentLength: 0, Body: http.NoBody}
+	page, ok := f.pages[crawlUrl]
+	if ok == false {
+		return
+	}
+	resp.StatusCode = page.StatusCode
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	for name, values := range page.Header {
+		resp.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	if resp.Header.Get("Content-Type") == "" {
+		resp.Header.Set("Content-Type", http.DetectContentType([]byte(page.Body)))
+	}
+	resp.ContentLength = int64(len(page.Body))
+	if method != "HEAD" {
+		resp.Body = io.NopCloser(strings.NewReader(page.Body))
+	}
+	return
+}
+
+// request headers set by the crawler: User-Agent and basic auth
+func (c *Crawler) requestHeader() (header http.Header) {
+	header = make(http.Header)
+	if c.UserAgent != nil {
+		header.Set("User-Agent", *c.UserAgent)
+	}
+	if c.Auth != nil {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.Auth.Username+":"+c.Auth.Password)))
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemoryFetcher(t *testing.T) {
+	c := NewCrawler()
+	c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{
+		"http://a/":           {Body: `<html><a href="/b">b</a><a href="/old">old</a><a href="/missing">m</a></html>`},
+		"http://a/b":          {Header: http.Header{"Content-Type": []string{"text/html"}}, Body: `<a href="/">home</a>`},
+		"http://a/old":        {StatusCode: 301, Header: http.Header{"Location": []string{"/b"}}},
+		"http://a/robots.txt": {Body: "User-agent: *\nDisallow:\n"},
+	})
+	mutex := &sync.Mutex{}
+	results := make(map[string]*FoundUrls)
+	err := c.CrawlContext(context.Background(), "http://a/", func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[u.CrawlUrl] = u
+	})
+	var urls []string
+	for crawlUrl := range results {
+		urls = append(urls, crawlUrl)
+	}
+	sort.Strings(urls)
+	if err != nil || len(results) != 4 {
+		t.Errorf("%v: %v", err, urls)
+		t.FailNow()
+	}
+	if u := results["http://a/"]; u.StatusCode != 200 || len(u.FoundUrls) != 3 || u.Timings == nil {
+		t.Errorf("seed: %+v", u)
+	}
+	if u := results["http://a/old"]; len(u.Redirects) != 1 || u.Redirects[0].Location != "http://a/b" {
+		t.Errorf("redirect: %+v", u)
+	}
+	if u := results["http://a/missing"]; u.StatusCode != 404 || u.Err == nil {
+		t.Errorf("missing: %+v", u)
+	}
+}
+
+func TestFSFetcher(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/index.html":      {Data: []byte("<html>home</html>")},
+		"site/docs/index.html": {Data: []byte("<html>docs</html>")},
+		"site/style.css":       {Data: []byte("body {}")},
+		"site/data":            {Data: []byte("<html>sniffed</html>")},
+	}
+	sub, _ := fs.Sub(fsys, "site")
+	f, err := NewFSFetcher(sub, "http://docs.local/base")
+	if err != nil {
+		t.Errorf("NewFSFetcher: %s", err)
+		t.FailNow()
+	}
+	checks := []struct {
+		url         string
+		status      int
+		contentType string
+		body        string
+		location    string
+	}{
+		{"http://docs.local/base/", 200, "text/html; charset=utf-8", "<html>home</html>", ""},
+		{"http://docs.local/base", 301, "", "", "http://docs.local/base/"},
+		{"http://docs.local/base/docs", 301, "", "", "http://docs.local/base/docs/"},
+		{"http://docs.local/base/docs/", 200, "text/html; charset=utf-8", "<html>docs</html>", ""},
+		{"http://docs.local/base/style.css", 200, "text/css; charset=utf-8", "body {}", ""},
+		{"http://docs.local/base/data", 200, "text/html; charset=utf-8", "<html>sniffed</html>", ""},
+		{"http://docs.local/base/nope.html", 404, "", "", ""},
+	}
+	for _, check := range checks {
+		resp, err := f.Fetch(context.Background(), "GET", check.url, nil)
+		if err != nil {
+			t.Errorf("%s: %s", check.url, err)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != check.status || resp.Header.Get("Content-Type") != check.contentType || string(body) != check.body || resp.Header.Get("Location") != check.location {
+			t.Errorf("%s: %d %q %q %q", check.url, resp.StatusCode, resp.Header.Get("Content-Type"), body, resp.Header.Get("Location"))
+		}
+	}
+	for _, outside := range []string{"http://docs.local/other/", "http://other/base/", "http://docs.local/base/../secret"} {
+		if _, err := f.Fetch(context.Background(), "GET", outside, nil); err == nil {
+			t.Errorf("%s: expected error", outside)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package crawler
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// number of words in a single SimHash feature
+const simHashShingle = 3
+
+// 64-bit SimHash of the visible text of an html page, using word shingles as features
+// pages with similar text have fingerprints differing in few bits
+func simHash(body []byte) uint64 {
+	var words []string
+	skip := 0
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.StartTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			if string(name) == "script" || string(name) == "style" {
+				if tt == html.StartTagToken {
+					skip += 1
+				} else if skip > 0 {
+					skip -= 1
+				}
+			}
+		case html.TextToken:
+			if skip == 0 {
+				words = append(words, strings.FieldsFunc(strings.ToLower(string(z.Text())), func(r rune) bool {
+					return unicode.IsLetter(r) == false && unicode.IsNumber(r) == false
+				})...)
+			}
+		}
+	}
+	n := simHashShingle
+	if len(words) < n {
+		n = len(words)
+	}
+	var weights [64]int
+	for i := 0; i+n <= len(words) && n > 0; i++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(strings.Join(words[i:i+n], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit] += 1
+			} else {
+				weights[bit] -= 1
+			}
+		}
+	}
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << uint(bit)
+		}
+	}
+	return fingerprint
+}
+
+// single page in the near-duplicate index
+type nearDuplicateEntry struct {
+	fingerprint uint64
+	cluster     string
+}
+
+// finds pages whose SimHash differs in at most distance bits from an earlier page
+// fingerprints are split into distance+1 blocks, two fingerprints within distance share at least one block exactly,
+// so only pages sharing a block are compared
+type nearDuplicates struct {
+	mutex    *sync.Mutex
+	distance int
+	blocks   int
+	index    []map[uint64][]*nearDuplicateEntry
+}
+
+func newNearDuplicates(distance int) (d *nearDuplicates) {
+	d = new(nearDuplicates)
+	d.mutex = &sync.Mutex{}
+	if distance < 0 {
+		distance = 0
+	}
+	if distance > 63 {
+		distance = 63
+	}
+	d.distance = distance
+	d.blocks = distance + 1
+	d.index = make([]map[uint64][]*nearDuplicateEntry, d.blocks)
+	for i := range d.index {
+		d.index[i] = make(map[uint64][]*nearDuplicateEntry)
+	}
+	return
+}
+
+// value of block i of fingerprint
+func (d *nearDuplicates) block(fingerprint uint64, i int) uint64 {
+	start := i * 64 / d.blocks
+	end := (i + 1) * 64 / d.blocks
+	return (fingerprint >> uint(start)) & (1<<uint(end-start) - 1)
+}
+
+// adds page to the index, returns the first page of its cluster, or empty string if it is not a near-duplicate
+// a page crawled again, e.g. after resuming from a checkpoint, is not a near-duplicate of itself
+func (d *nearDuplicates) add(crawlUrl string, fingerprint uint64) (duplicateOf string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	entry := &nearDuplicateEntry{fingerprint: fingerprint, cluster: crawlUrl}
+	for i := 0; i < d.blocks && duplicateOf == ""; i++ {
+		for _, other := range d.index[i][d.block(fingerprint, i)] {
+			if bits.OnesCount64(other.fingerprint^fingerprint) <= d.distance {
+				duplicateOf = other.cluster
+				entry.cluster = other.cluster
+				break
+			}
+		}
+	}
+	d.insert(entry)
+	if duplicateOf == crawlUrl {
+		duplicateOf = ""
+	}
+	return
+}
+
+// adds entry to each block of the index; caller holds the mutex
+func (d *nearDuplicates) insert(entry *nearDuplicateEntry) {
+	for i := 0; i < d.blocks; i++ {
+		key := d.block(entry.fingerprint, i)
+		d.index[i][key] = append(d.index[i][key], entry)
+	}
+}
+
+// single page of the index in a checkpoint
+type savedNearDuplicate struct {
+	Fingerprint uint64
+	Cluster     string
+}
+
+// all pages of the index, for checkpoints, each entry is in every block so the first block has them all
+func (d *nearDuplicates) save() (entries []savedNearDuplicate) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, block := range d.index[0] {
+		for _, entry := range block {
+			entries = append(entries, savedNearDuplicate{Fingerprint: entry.fingerprint, Cluster: entry.cluster})
+		}
+	}
+	return
+}
+
+// restores pages saved by save
+func (d *nearDuplicates) load(entries []savedNearDuplicate) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, entry := range entries {
+		d.insert(&nearDuplicateEntry{fingerprint: entry.Fingerprint, cluster: entry.Cluster})
+	}
+}
@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+func TestSimHash(t *testing.T) {
+	var text []string
+	for i := 0; i < 2000; i++ {
+		text = append(text, fmt.Sprintf("word%d", i))
+	}
+	page := "<html><head><style>body { color: red }</style><script>var x = 1;</script></head><body><p>%s</p></body></html>"
+	a := simHash([]byte(fmt.Sprintf(page, strings.Join(text, " "))))
+	text[100] = "changed"
+	b := simHash([]byte(fmt.Sprintf(page, strings.Join(text, " "))))
+	c := simHash([]byte(fmt.Sprintf(page, "something else entirely, nothing like the other pages at all")))
+	if bits.OnesCount64(a^b) > 10 {
+		t.Errorf("similar pages differ in %d bits", bits.OnesCount64(a^b))
+	}
+	if bits.OnesCount64(a^c) <= 20 {
+		t.Errorf("different pages differ in %d bits only", bits.OnesCount64(a^c))
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	d := newNearDuplicates(3)
+	checks := []struct {
+		url         string
+		fingerprint uint64
+		duplicateOf string
+	}{
+		{"a", 0xf0f0f0f0f0f0f0f0, ""},
+		{"b", 0x0f0f0f0f0f0f0f0f, ""},
+		{"a2", 0xf0f0f0f0f0f0f0f0 ^ 1<<63 ^ 1<<40 ^ 1, "a"},
+		{"a3", 0xf0f0f0f0f0f0f0f0 ^ 1<<63 ^ 1<<40 ^ 1 ^ 1<<20, "a"},
+		{"c", 0xf0f0f0f0f0f0f0f0 ^ 0xff, ""},
+	}
+	for _, check := range checks {
+		if dup := d.add(check.url, check.fingerprint); dup != check.duplicateOf {
+			t.Errorf("%s: expected duplicate of %q, got %q", check.url, check.duplicateOf, dup)
+		}
+	}
+}
+
+func TestHashLoopCheck(t *testing.T) {
+	c := NewCrawler()
+	c.HashLoopCheck = true
+	w := newCrawlWorker(context.Background(), c, "https://example.com/", func(*FoundUrls) {})
+	bodies := map[string]string{"/a": "<p>one</p>", "/b": "<p>two</p>", "/c": "<p>one</p>"}
+	for _, path := range []string{"/a", "/b", "/c"} {
+		u := &FoundUrls{CrawlUrl: "https://example.com" + path}
+		resp := &Response{Body: io.NopCloser(strings.NewReader(bodies[path]))}
+		body, err := w.crawlWorkHashLoopCheck(u, resp)
+		if path == "/c" {
+			if err == nil || strings.Contains(err.Error(), "https://example.com/a") == false {
+				t.Errorf("%s: expected loop error, got %v", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", path, err)
+			continue
+		}
+		if read, _ := io.ReadAll(body); string(read) != bodies[path] {
+			t.Errorf("%s: body not passed on: %s", path, read)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// single unit of work in the frontier: URL to crawl, the depth it was found at and the page it was found on
+// CheckOnly jobs are only checked for existence, not parsed
+type crawlJob struct {
+	Url       string
+	Depth     int
+	CheckOnly bool
+	Referrer  string
+}
+
+// crawl frontier, a FIFO queue shared by all workers
+// keeps up to memLimit jobs in memory, anything above that is spilled to a temporary file and read back in order
+// pending counts jobs queued plus jobs being worked on, once it drops to 0 the crawl is finished
+// active counts jobs being worked on, paused stops handing out jobs, so the queue can be saved while nothing is in flight
+type frontier struct {
+	mutex    *sync.Mutex
+	cond     *sync.Cond
+	mem      []crawlJob
+	memLimit int
+	spillW   *os.File
+	spillBuf *bufio.Writer
+	spillR   *bufio.Reader
+	spillRF  *os.File
+	spilled  int
+	pending  int
+	active   int
+	paused   bool
+	closed   bool
+	dropped  int
+}
+
+// creates a new frontier, memLimit <= 0 means keep everything in memory
+func newFrontier(memLimit int) (f *frontier) {
+	f = new(frontier)
+	f.mutex = &sync.Mutex{}
+	f.cond = sync.NewCond(f.mutex)
+	f.memLimit = memLimit
+	return
+}
+
+// adds a job to the end of the queue and wakes up one waiting worker
+func (f *frontier) push(job crawlJob) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed == true {
+		// found by a job still in flight when the frontier was closed
+		f.dropped += 1
+		return
+	}
+	f.pending += 1
+	// once anything got spilled, new jobs must go to the spill file too, to keep FIFO order
+	if f.memLimit <= 0 || (f.spilled == 0 && len(f.mem) < f.memLimit) || f.spillPush(job) != nil {
+		f.mem = append(f.mem, job)
+	}
+	f.cond.Signal()
+}
+
+// takes a job from the front of the queue, blocks while the queue is empty but other workers may still add jobs
+// returns ok == false once the crawl is finished or the frontier was closed
+func (f *frontier) pop() (job crawlJob, ok bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for ((len(f.mem) == 0 && f.spilled == 0 && f.pending > 0) || f.paused == true) && f.closed == false {
+		f.cond.Wait()
+	}
+	if f.closed == true || (len(f.mem) == 0 && f.spilled == 0) {
+		return
+	}
+	if len(f.mem) == 0 {
+		f.spillRefill()
+	}
+	if len(f.mem) == 0 {
+		return
+	}
+	job = f.mem[0]
+	f.mem[0] = crawlJob{}
+	f.mem = f.mem[1:]
+	f.active += 1
+	ok = true
+	return
+}
+
+// marks a job taken by pop() as finished, wakes everyone up when there is nothing left to do
+func (f *frontier) done() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.pending -= 1
+	f.active -= 1
+	if f.pending <= 0 || f.active == 0 {
+		f.cond.Broadcast()
+	}
+}
+
+// stops handing out jobs and waits until all jobs taken by pop() are done, or the frontier is closed
+func (f *frontier) pause() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.paused = true
+	for f.active > 0 && f.closed == false {
+		f.cond.Wait()
+	}
+}
+
+// hands out jobs again after pause()
+func (f *frontier) resume() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.paused = false
+	f.cond.Broadcast()
+}
+
+// writes all queued jobs in order to w, one spill file line each, including spilled ones, without taking them off the queue
+// spilled jobs are copied line by line, the queue is never loaded into memory as a whole
+func (f *frontier) snapshot(w io.Writer) (err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, job := range f.mem {
+		err = writeSpillLine(w, job)
+		if err != nil {
+			return
+		}
+	}
+	if f.spilled == 0 {
+		return
+	}
+	err = f.spillBuf.Flush()
+	if err != nil {
+		return makeError("spill flush: %s", err)
+	}
+	// unread part of the spill file: what the reader has buffered, then the rest of the file
+	offset, err := f.spillRF.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return makeError("spill seek: %s", err)
+	}
+	buffered, _ := f.spillR.Peek(f.spillR.Buffered())
+	r := bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), io.NewSectionReader(f.spillRF, offset, math.MaxInt64-offset)))
+	for i := 0; i < f.spilled; i++ {
+		line, errR := r.ReadString('\n')
+		if errR != nil {
+			return makeError("spill read: %s", errR)
+		}
+		_, err = io.WriteString(w, line)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// stops the frontier, all pop() calls return immediately, removes spill file
+// jobs still queued at this point, and jobs pushed later, are dropped and counted in dropped
+func (f *frontier) close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closed = true
+	f.dropped += len(f.mem) + f.spilled
+	f.mem = nil
+	f.spilled = 0
+	if f.spillW != nil {
+		name := f.spillW.Name()
+		_ = f.spillW.Close()
+		_ = f.spillRF.Close()
+		_ = os.Remove(name)
+		f.spillW = nil
+	}
+	f.cond.Broadcast()
+}
+
+// returns number of jobs that were dropped by close() without being crawled
+func (f *frontier) droppedCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.dropped
+}
+
+// writes job to the spill file, creating it on first use; caller holds the mutex
+func (f *frontier) spillPush(job crawlJob) (err error) {
+	if f.spillW == nil {
+		f.spillW, err = os.CreateTemp("", "crawler-frontier-*")
+		if err != nil {
+			return makeError("CreateTemp: %s", err)
+		}
+		f.spillRF, err = os.Open(f.spillW.Name())
+		if err != nil {
+			_ = f.spillW.Close()
+			_ = os.Remove(f.spillW.Name())
+			f.spillW = nil
+			return makeError("Open: %s", err)
+		}
+		f.spillBuf = bufio.NewWriter(f.spillW)
+		f.spillR = bufio.NewReader(f.spillRF)
+	}
+	err = writeSpillLine(f.spillBuf, job)
+	if err != nil {
+		return makeError("spill write: %s", err)
+	}
+	f.spilled += 1
+	return
+}
+
+// reads up to memLimit jobs back from the spill file into memory; caller holds the mutex
+func (f *frontier) spillRefill() {
+	if f.spillBuf.Flush() != nil {
+		return
+	}
+	for f.spilled > 0 && len(f.mem) < f.memLimit {
+		line, err := f.spillR.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f.spilled -= 1
+		job, ok := parseSpillLine(line)
+		if ok == false {
+			f.pending -= 1
+			continue
+		}
+		f.mem = append(f.mem, job)
+	}
+}
+
+// writes job as a single line of the spill file
+func writeSpillLine(w io.Writer, job crawlJob) (err error) {
+	_, err = fmt.Fprintf(w, "%d %t %s %s\n", job.Depth, job.CheckOnly, strconv.Quote(job.Url), strconv.Quote(job.Referrer))
+	return
+}
+
+// parses a line of the spill file, as written by writeSpillLine
+func parseSpillLine(line string) (job crawlJob, ok bool) {
+	parts := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 3)
+	if len(parts) != 3 {
+		return
+	}
+	depth, errD := strconv.Atoi(parts[0])
+	checkOnly, errC := strconv.ParseBool(parts[1])
+	// quoted URL and referrer, separated by a space
+	quotedUrl, errU := strconv.QuotedPrefix(parts[2])
+	u, _ := strconv.Unquote(quotedUrl)
+	referrer, errR := strconv.Unquote(strings.TrimPrefix(parts[2][len(quotedUrl):], " "))
+	if errD != nil || errC != nil || errU != nil || errR != nil {
+		return
+	}
+	return crawlJob{Url: u, Depth: depth, CheckOnly: checkOnly, Referrer: referrer}, true
+}
@@ -0,0 +1,139 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrontierSpill(t *testing.T) {
+	f := newFrontier(2)
+	defer f.close()
+	for i := 0; i < 5; i++ {
+		f.push(crawlJob{Url: fmt.Sprintf("http://a/%d\n", i), Depth: i, Referrer: fmt.Sprintf("http://r/ \"%d\"", i)})
+	}
+	check := func(what string, i int, job crawlJob) {
+		if job.Url != fmt.Sprintf("http://a/%d\n", i) || job.Depth != i || job.Referrer != fmt.Sprintf("http://r/ \"%d\"", i) {
+			t.Errorf("%s %d: %v", what, i, job)
+			t.FailNow()
+		}
+	}
+	for i := 0; i < 5; i++ {
+		job, ok := f.pop()
+		if ok == false {
+			t.Errorf("pop %d: empty", i)
+			t.FailNow()
+		}
+		check("pop", i, job)
+		f.done()
+		if i != 2 {
+			continue
+		}
+		// jobs 3 and 4 are left, one in memory and one read back from the spill file into the reader's buffer
+		buf := new(bytes.Buffer)
+		err := f.snapshot(buf)
+		buf.WriteString("\nrest")
+		var jobs []crawlJob
+		br := bufio.NewReader(buf)
+		if err == nil {
+			err = readCheckpointFrontier(br, func(job crawlJob) {
+				jobs = append(jobs, job)
+			})
+		}
+		if rest, _ := br.ReadString('\n'); err != nil || len(jobs) != 2 || rest != "rest" {
+			t.Errorf("snapshot: %v %v", err, jobs)
+			t.FailNow()
+		}
+		check("snapshot", 3, jobs[0])
+		check("snapshot", 4, jobs[1])
+	}
+	if _, ok := f.pop(); ok == true {
+		t.FailNow()
+	}
+}
+
+// fetcher recording the max number of concurrent Fetch calls
+type concurrencyFetcher struct {
+	fetcher Fetcher
+	mutex   sync.Mutex
+	running int
+	max     int
+}
+
+func (f *concurrencyFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (resp *Response, err error) {
+	f.mutex.Lock()
+	f.running += 1
+	if f.running > f.max {
+		f.max = f.running
+	}
+	f.mutex.Unlock()
+	time.Sleep(time.Millisecond)
+	defer func() {
+		f.mutex.Lock()
+		f.running -= 1
+		f.mutex.Unlock()
+	}()
+	return f.fetcher.Fetch(ctx, method, crawlUrl, header)
+}
+
+func TestFrontierCrawl(t *testing.T) {
+	// every page links to all others, each one must still be crawled once, by at most Workers goroutines at once
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Workers = 3
+	fetcher := &concurrencyFetcher{fetcher: NewMemoryFetcher(resultsTestPages(30))}
+	c.Fetcher = fetcher
+	reported := make(map[string]int)
+	c.SerializeCallbacks = true
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		reported[u.CrawlUrl] += 1
+	})
+	if len(reported) != 31 {
+		t.Errorf("expected 31 URLs, got %d", len(reported))
+	}
+	for crawlUrl, count := range reported {
+		if count != 1 {
+			t.Errorf("%s crawled %d times", crawlUrl, count)
+		}
+	}
+	if fetcher.max > 3 || fetcher.max < 2 {
+		t.Errorf("expected up to 3 concurrent fetches, got %d", fetcher.max)
+	}
+}
+
+func TestFrontierCrawlWide(t *testing.T) {
+	// one page linking to 10k pages, most of the frontier is spilled to disk
+	var body strings.Builder
+	pages := make(map[string]*MemoryPage)
+	for i := 0; i < 10000; i++ {
+		_, _ = fmt.Fprintf(&body, `<a href="/%d">%d</a>`, i, i)
+		pages[fmt.Sprintf("http://a/%d", i)] = &MemoryPage{Body: "leaf"}
+	}
+	pages["http://a/"] = &MemoryPage{Body: body.String()}
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.FrontierMemoryLimit = 100
+	c.Fetcher = NewMemoryFetcher(pages)
+	reported := make(map[string]int)
+	c.SerializeCallbacks = true
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		reported[u.CrawlUrl] += 1
+		if u.Err != nil || u.StatusCode != 200 {
+			t.Errorf("%s: %d %s", u.CrawlUrl, u.StatusCode, u.Err)
+		}
+	})
+	if len(reported) != 10001 {
+		t.Errorf("expected 10001 URLs, got %d", len(reported))
+	}
+	for crawlUrl, count := range reported {
+		if count != 1 {
+			t.Errorf("%s crawled %d times", crawlUrl, count)
+		}
+	}
+}
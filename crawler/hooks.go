@@ -0,0 +1,156 @@
+package crawler
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// called before a URL is queued: the seed, found links and redirect targets crawled on their own, and before a redirect target is followed
+// returns the URL to queue instead, used as is, or ok == false to drop it
+type EnqueueHook func(crawlUrl string, depth int, referrer string) (newUrl string, ok bool)
+
+// called before each request, including retries, redirect hops and robots.txt, header can be modified
+type RequestHook func(method string, crawlUrl string, header http.Header)
+
+// called with the final response of a URL, after redirects, before the body is read
+// resp.Body must not be read, returning an error stops processing of the URL, which is reported with the error
+type ResponseHook func(u *FoundUrls, resp *Response) (err error)
+
+// called with links found on a page, absolute and normalized, before scope, filter and trap decisions are made
+// returns links to use instead, links can be removed, changed or added, added links must be absolute URLs
+type LinksHook func(u *FoundUrls, links []*Link) []*Link
+
+// called for each URL reported with Err set, before the complete hooks
+type ErrorHook func(u *FoundUrls)
+
+// called for each URL reported, just before the callback
+type CompleteHook func(u *FoundUrls)
+
+// hooks called around each crawl stage, see Crawler.Hooks
+// hooks of each kind run in the order they were added, concurrently from all workers, same as the callback
+// a panicking hook fails the URL it was called for with *HookPanicError, the remaining hooks of that kind are skipped
+type Hooks struct {
+	Enqueue  []EnqueueHook
+	Request  []RequestHook
+	Response []ResponseHook
+	Links    []LinksHook
+	Error    []ErrorHook
+	Complete []CompleteHook
+}
+
+// adds hook called before a URL is queued
+func (h *Hooks) OnEnqueue(hook EnqueueHook) {
+	h.Enqueue = append(h.Enqueue, hook)
+}
+
+// adds hook called before each request
+func (h *Hooks) OnRequest(hook RequestHook) {
+	h.Request = append(h.Request, hook)
+}
+
+// adds hook called with the final response of a URL
+func (h *Hooks) OnResponse(hook ResponseHook) {
+	h.Response = append(h.Response, hook)
+}
+
+// adds hook called with links found on a page
+func (h *Hooks) OnLinks(hook LinksHook) {
+	h.Links = append(h.Links, hook)
+}
+
+// adds hook called for each URL reported with an error
+func (h *Hooks) OnError(hook ErrorHook) {
+	h.Error = append(h.Error, hook)
+}
+
+// adds hook called for each URL reported
+func (h *Hooks) OnComplete(hook CompleteHook) {
+	h.Complete = append(h.Complete, hook)
+}
+
+// calls fn, turning a panic into *HookPanicError
+func callHook(hook string, crawlUrl string, fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &HookPanicError{Hook: hook, Url: crawlUrl, Value: r, Stack: debug.Stack()}
+		}
+	}()
+	fn()
+	return
+}
+
+// runs enqueue hooks, each one gets the URL returned by the previous one
+func (h *Hooks) enqueue(crawlUrl string, depth int, referrer string) (newUrl string, ok bool, err error) {
+	newUrl, ok = crawlUrl, true
+	for _, hook := range h.Enqueue {
+		err = callHook("OnEnqueue", newUrl, func() {
+			newUrl, ok = hook(newUrl, depth, referrer)
+		})
+		if err != nil || ok == false {
+			return
+		}
+	}
+	return
+}
+
+// runs request hooks
+func (h *Hooks) request(method string, crawlUrl string, header http.Header) (err error) {
+	for _, hook := range h.Request {
+		err = callHook("OnRequest", crawlUrl, func() {
+			hook(method, crawlUrl, header)
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// runs response hooks, stops at the first error
+func (h *Hooks) response(u *FoundUrls, resp *Response) (err error) {
+	for _, hook := range h.Response {
+		errP := callHook("OnResponse", u.CrawlUrl, func() {
+			err = hook(u, resp)
+		})
+		if errP != nil {
+			return errP
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// runs links hooks, each one gets the links returned by the previous one
+func (h *Hooks) links(u *FoundUrls, links []*Link) (result []*Link, err error) {
+	result = links
+	for _, hook := range h.Links {
+		err = callHook("OnLinks", u.CrawlUrl, func() {
+			result = hook(u, result)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// runs error hooks if u has an error, then complete hooks; a panic is recorded in u.Err unless it already has an error
+func (h *Hooks) complete(u *FoundUrls) {
+	if u.Err != nil {
+		for _, hook := range h.Error {
+			if err := callHook("OnError", u.CrawlUrl, func() { hook(u) }); err != nil {
+				break
+			}
+		}
+	}
+	for _, hook := range h.Complete {
+		if err := callHook("OnComplete", u.CrawlUrl, func() { hook(u) }); err != nil {
+			if u.Err == nil {
+				u.Err = err
+			}
+			break
+		}
+	}
+}
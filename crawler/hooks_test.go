@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// records request headers, for OnRequest
+type headerFetcher struct {
+	Fetcher
+	mutex   *sync.Mutex
+	headers map[string]string
+}
+
+func (f *headerFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (*Response, error) {
+	f.mutex.Lock()
+	f.headers[crawlUrl] = header.Get("X-Test")
+	f.mutex.Unlock()
+	return f.Fetcher.Fetch(ctx, method, crawlUrl, header)
+}
+
+func TestHooks(t *testing.T) {
+	fetcher := &headerFetcher{mutex: &sync.Mutex{}, headers: make(map[string]string), Fetcher: NewMemoryFetcher(map[string]*MemoryPage{
+		"http://a/":       {Body: `<a href="/private">p</a><a href="/old-name">o</a><a href="/stop">s</a><a href="/panic">x</a>`},
+		"http://a/new":    {Body: `<html>new</html>`},
+		"http://a/stop":   {Body: `<html>stop</html>`},
+		"http://a/panic":  {Body: `<a href="/never">n</a>`},
+		"http://a/extra":  {Body: `<html>extra</html>`},
+		"http://a/never":  {Body: `<html>never</html>`},
+		"http://a/unseen": {Body: `<html>unseen</html>`},
+	})}
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = fetcher
+	var order []string
+	mutex := &sync.Mutex{}
+	record := func(event string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		order = append(order, event)
+	}
+	c.Hooks.OnEnqueue(func(crawlUrl string, depth int, referrer string) (string, bool) {
+		if strings.HasSuffix(crawlUrl, "/private") {
+			return "", false
+		}
+		return strings.Replace(crawlUrl, "/old-name", "/new", 1), true
+	})
+	c.Hooks.OnRequest(func(method string, crawlUrl string, header http.Header) {
+		header.Set("X-Test", "hooked")
+	})
+	c.Hooks.OnResponse(func(u *FoundUrls, resp *Response) error {
+		if strings.HasSuffix(u.CrawlUrl, "/stop") {
+			return errors.New("stopped")
+		}
+		return nil
+	})
+	c.Hooks.OnLinks(func(u *FoundUrls, links []*Link) []*Link {
+		if strings.HasSuffix(u.CrawlUrl, "/panic") {
+			panic("boom")
+		}
+		if u.Depth == 0 {
+			links = append(links, &Link{Url: "http://a/extra", Kind: LinkNavigation})
+		}
+		return links
+	})
+	c.Hooks.OnError(func(u *FoundUrls) {
+		record("error " + u.CrawlUrl)
+	})
+	c.Hooks.OnComplete(func(u *FoundUrls) {
+		record("complete " + u.CrawlUrl)
+	})
+	results := make(map[string]*FoundUrls)
+	_ = c.CrawlContext(context.Background(), "http://a/", func(u *FoundUrls) {
+		record("callback " + u.CrawlUrl)
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[u.CrawlUrl] = u
+	})
+
+	if len(results) != 5 || results["http://a/private"] != nil || results["http://a/new"] == nil || results["http://a/extra"] == nil || results["http://a/never"] != nil {
+		t.Errorf("unexpected results: %v", order)
+	}
+	if u := results["http://a/stop"]; u == nil || u.Err == nil || u.Err.Error() != "stopped" {
+		t.Errorf("OnResponse: %+v", u)
+	}
+	var panicErr *HookPanicError
+	if u := results["http://a/panic"]; u == nil || errors.As(u.Err, &panicErr) == false || panicErr.Hook != "OnLinks" {
+		t.Errorf("OnLinks panic: %+v", u)
+	}
+	if fetcher.headers["http://a/new"] != "hooked" {
+		t.Errorf("OnRequest: %v", fetcher.headers)
+	}
+	for i, event := range order {
+		if event == "error http://a/stop" && (i+2 >= len(order) || order[i+1] != "complete http://a/stop" || order[i+2] != "callback http://a/stop") {
+			t.Errorf("hook order: %v", order)
+		}
+	}
+}
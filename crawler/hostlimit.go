@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// politeness limits applied to each host separately
+type HostLimit struct {
+	// max requests per second to the host, token bucket refill rate, 0 == unlimited
+	RequestsPerSecond float64
+
+	// token bucket size, number of requests which can be made at once after being idle
+	Burst int
+
+	// max concurrent requests to the host, 0 == unlimited
+	MaxConnections int
+}
+
+// state of a single host: token bucket and connection slots
+type hostState struct {
+	limit  HostLimit
+	mutex  *sync.Mutex
+	tokens float64
+	last   time.Time
+	slots  chan struct{}
+}
+
+// enforces Crawler.HostLimit and Crawler.HostLimits in the fetch path
+type hostLimiter struct {
+	mutex     *sync.Mutex
+	defaults  HostLimit
+	overrides map[string]HostLimit
+	hosts     map[string]*hostState
+}
+
+func newHostLimiter(defaults HostLimit, overrides map[string]HostLimit) (l *hostLimiter) {
+	l = new(hostLimiter)
+	l.mutex = &sync.Mutex{}
+	l.defaults = defaults
+	l.overrides = make(map[string]HostLimit)
+	for host, limit := range overrides {
+		l.overrides[strings.ToLower(host)] = limit
+	}
+	l.hosts = make(map[string]*hostState)
+	return
+}
+
+// returns state for host (host or host:port), override for host:port wins over override for host name
+func (l *hostLimiter) get(host string) (st *hostState) {
+	host = strings.ToLower(host)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	st = l.hosts[host]
+	if st != nil {
+		return
+	}
+	limit, ok := l.overrides[host]
+	if ok == false {
+		name := host
+		if i := strings.LastIndex(name, ":"); i >= 0 && strings.HasSuffix(name, "]") == false {
+			name = name[:i]
+		}
+		limit, ok = l.overrides[name]
+		if ok == false {
+			limit = l.defaults
+		}
+	}
+	st = &hostState{limit: limit, mutex: &sync.Mutex{}, last: time.Now()}
+	if limit.Burst < 1 {
+		st.limit.Burst = 1
+	}
+	st.tokens = float64(st.limit.Burst)
+	if limit.MaxConnections > 0 {
+		st.slots = make(chan struct{}, limit.MaxConnections)
+	}
+	l.hosts[host] = st
+	return
+}
+
+// waits for a connection slot and a token for host, returns func to call once the request is fully done
+// fails right away once ctx is cancelled
+func (l *hostLimiter) acquire(ctx context.Context, host string) (release func(), err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	st := l.get(host)
+	release = func() {}
+	if st.slots != nil {
+		select {
+		case st.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { <-st.slots }) }
+	}
+	if st.limit.RequestsPerSecond <= 0 {
+		return
+	}
+	// take a token, going negative reserves a future one, then sleep until it is ours
+	st.mutex.Lock()
+	now := time.Now()
+	st.tokens = math.Min(float64(st.limit.Burst), st.tokens+now.Sub(st.last).Seconds()*st.limit.RequestsPerSecond)
+	st.last = now
+	st.tokens -= 1
+	wait := time.Duration(0)
+	if st.tokens < 0 {
+		wait = time.Duration(-st.tokens / st.limit.RequestsPerSecond * float64(time.Second))
+	}
+	st.mutex.Unlock()
+	if wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return
+}
+
+// response body which gives back the host connection slot once closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterRate(t *testing.T) {
+	l := newHostLimiter(HostLimit{RequestsPerSecond: 20, Burst: 1}, map[string]HostLimit{"fast.example.com": {}})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		release, err := l.acquire(context.Background(), "example.com:8080")
+		if err != nil {
+			t.FailNow()
+		}
+		release()
+	}
+	// first token is there from the start, 4 more at 50ms each
+	if time.Since(start) < 180*time.Millisecond {
+		t.Errorf("rate not enforced: %s", time.Since(start))
+	}
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		release, _ := l.acquire(context.Background(), "fast.example.com")
+		release()
+	}
+	if time.Since(start) > 50*time.Millisecond {
+		t.Errorf("override not used: %s", time.Since(start))
+	}
+}
+
+func TestHostLimiterConnections(t *testing.T) {
+	l := newHostLimiter(HostLimit{MaxConnections: 1}, nil)
+	release, err := l.acquire(context.Background(), "example.com")
+	if err != nil {
+		t.FailNow()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = l.acquire(ctx, "example.com"); err == nil {
+		t.Error("second connection allowed")
+	}
+	release()
+	if _, err = l.acquire(context.Background(), "example.com"); err != nil {
+		t.Error("slot not released")
+	}
+}
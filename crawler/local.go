@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// returns file:// URL of a local file or directory, directories end with /
+// rawPath is either a file:// URL or a path, ok == false if it is neither a file:// URL nor an existing path
+func localUrl(rawPath string) (u *url.URL, ok bool) {
+	if strings.HasPrefix(rawPath, "file://") {
+		parsed, err := url.Parse(rawPath)
+		if err != nil {
+			return nil, false
+		}
+		rawPath = filepath.FromSlash(parsed.Path)
+	} else if strings.Contains(rawPath, "://") {
+		return nil, false
+	}
+	abs, err := filepath.Abs(rawPath)
+	if err != nil {
+		return nil, false
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, false
+	}
+	p := filepath.ToSlash(abs)
+	if strings.HasPrefix(p, "/") == false {
+		// windows drive letter
+		p = "/" + p
+	}
+	if info.IsDir() == true && strings.HasSuffix(p, "/") == false {
+		p += "/"
+	}
+	return &url.URL{Scheme: "file", Path: p}, true
+}
+
+// for a local seed (file:// URL or path), returns its file:// URL and the site root
+// the site root is siteRoot if it is an existing directory, the seed's directory otherwise
+// ok == false means seed is not local and should be crawled as is
+func localSeed(seed string, siteRoot string) (seedUrl string, root *url.URL, ok bool) {
+	u, ok := localUrl(seed)
+	if ok == false {
+		return seed, nil, false
+	}
+	root = &url.URL{Scheme: "file", Path: u.Path}
+	if strings.HasSuffix(root.Path, "/") == false {
+		root.Path = path.Dir(root.Path) + "/"
+	}
+	if siteRoot != "" {
+		if r, okR := localUrl(siteRoot); okR == true && strings.HasSuffix(r.Path, "/") == true {
+			root = r
+		}
+	}
+	return u.String(), root, true
+}
+
+// serves file:// URLs from files, anything else from other
+type fileFetcher struct {
+	files Fetcher
+	other Fetcher
+}
+
+func (f *fileFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (resp *Response, err error) {
+	if strings.HasPrefix(crawlUrl, "file:") {
+		return f.files.Fetch(ctx, method, crawlUrl, header)
+	}
+	return f.other.Fetch(ctx, method, crawlUrl, header)
+}
@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLocalCrawl(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":       `<html><a href="/docs/">docs</a><a href="about">about</a><a href="/missing/">missing</a><link rel="stylesheet" href="/css/site.css"></html>`,
+		"docs/index.html":  `<html><a href="/">home</a><a href="../about/">about</a></html>`,
+		"about/index.html": `<html><a href="https://example.org/">external</a></html>`,
+		"css/site.css":     `body {}`,
+	}
+	for name, body := range files {
+		_ = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Errorf("%s", err)
+			t.FailNow()
+		}
+	}
+	root, _ := localUrl(dir)
+	base := root.String()
+
+	c := NewCrawler()
+	mutex := &sync.Mutex{}
+	results := make(map[string]*FoundUrls)
+	err := c.CrawlContext(context.Background(), dir, func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[u.CrawlUrl] = u
+	})
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	if u := results[base]; u == nil || u.StatusCode != 200 || len(u.FoundUrls) != 4 {
+		t.Errorf("seed %s: %+v", base, u)
+		t.FailNow()
+	}
+	if u := results[base+"docs/"]; u == nil || u.StatusCode != 200 || *u.FoundUrls[0] != base {
+		t.Errorf("docs: %+v", u)
+	}
+	if u := results[base+"about"]; u == nil || len(u.Redirects) != 1 || u.Redirects[0].Location != base+"about/" {
+		t.Errorf("about: %+v", u)
+	}
+	if u := results[base+"css/site.css"]; u == nil || u.CheckOnly == false || u.StatusCode != 200 || u.ContentType != "text/css; charset=utf-8" {
+		t.Errorf("css: %+v", u)
+	}
+	if u := results[base+"missing/"]; u == nil || u.StatusCode != 404 {
+		t.Errorf("missing: %+v", u)
+	}
+	if _, ok := results["https://example.org/"]; ok == true {
+		t.Errorf("external link crawled")
+	}
+
+	// seed below the site root, root-relative links still resolve against the root
+	c.SiteRoot = dir
+	results = make(map[string]*FoundUrls)
+	_ = c.CrawlContext(context.Background(), "file://"+filepath.ToSlash(filepath.Join(dir, "docs"))+"/", func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[u.CrawlUrl] = u
+	})
+	if u := results[base+"docs/"]; u == nil || len(u.Links) != 2 || u.Links[0].Url != base || u.Links[0].InScope == true {
+		t.Errorf("site root: %+v", u)
+	}
+
+	// single file seed, its directory is the scope
+	c.SiteRoot = ""
+	results = make(map[string]*FoundUrls)
+	_ = c.CrawlContext(context.Background(), filepath.Join(dir, "index.html"), func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[u.CrawlUrl] = u
+	})
+	if u := results[base+"docs/"]; u == nil || u.StatusCode != 200 || results[base+"about/"] == nil {
+		t.Errorf("file seed: %v", results)
+	}
+}
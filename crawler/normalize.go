@@ -0,0 +1,190 @@
+package crawler
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// how Normalizer handles the trailing slash of the path
+type TrailingSlashPolicy int
+
+const (
+	// leave the path as it is
+	TrailingSlashKeep TrailingSlashPolicy = iota
+	// add a trailing slash, unless the last path segment looks like a file (has an extension)
+	TrailingSlashAdd
+	// remove the trailing slash, except for the root path
+	TrailingSlashRemove
+)
+
+// default Normalizer.RemoveParams, common tracking parameters
+var DefaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_ga", "_hsenc", "_hsmi", "yclid"}
+
+// URL canonicalization, applied to every URL before dedup, scope checks and output
+type Normalizer struct {
+	// lower-case scheme and host
+	LowercaseHost bool
+
+	// remove :80 from http and :443 from https URLs
+	DropDefaultPort bool
+
+	// resolve "." and ".." path segments, empty path becomes "/"
+	ResolveDotSegments bool
+
+	// remove #fragment
+	StripFragment bool
+
+	// sort query parameters by name, then value
+	SortQuery bool
+
+	// remove query parameters whose name matches any of these path.Match patterns, e.g. "utm_*"
+	RemoveParams []string
+
+	// trailing slash handling
+	TrailingSlash TrailingSlashPolicy
+}
+
+// creates a Normalizer with everything enabled, removing DefaultTrackingParams and keeping trailing slashes as they are
+func NewNormalizer() (n *Normalizer) {
+	n = new(Normalizer)
+	n.LowercaseHost = true
+	n.DropDefaultPort = true
+	n.ResolveDotSegments = true
+	n.StripFragment = true
+	n.SortQuery = true
+	n.RemoveParams = DefaultTrackingParams
+	n.TrailingSlash = TrailingSlashKeep
+	return
+}
+
+// returns canonical form of absolute URL rawUrl
+func (n *Normalizer) Normalize(rawUrl string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	if u.Opaque != "" {
+		// mailto:, javascript: and friends, nothing to normalize
+		return u.String(), nil
+	}
+	if n.LowercaseHost == true {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+	}
+	if n.DropDefaultPort == true {
+		port := u.Port()
+		if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+			u.Host = strings.TrimSuffix(u.Host, ":"+port)
+		}
+	}
+	p := u.EscapedPath()
+	if n.ResolveDotSegments == true {
+		p = removeDotSegments(p)
+		if p == "" && u.Host != "" {
+			p = "/"
+		}
+	}
+	switch n.TrailingSlash {
+	case TrailingSlashAdd:
+		if strings.HasSuffix(p, "/") == false && path.Ext(p) == "" {
+			p += "/"
+		}
+	case TrailingSlashRemove:
+		if len(p) > 1 {
+			p = strings.TrimRight(p, "/")
+			if p == "" {
+				p = "/"
+			}
+		}
+	}
+	if p != u.EscapedPath() {
+		unescaped, errP := url.PathUnescape(p)
+		if errP != nil {
+			return "", errP
+		}
+		u.Path = unescaped
+		u.RawPath = p
+	}
+	if n.StripFragment == true {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	u.RawQuery = n.normalizeQuery(u.RawQuery)
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+	}
+	return u.String(), nil
+}
+
+// removes tracking params and sorts the query, working on the raw query so encoding is kept as it was
+func (n *Normalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		remove := false
+		for _, pattern := range n.RemoveParams {
+			if match, _ := path.Match(pattern, name); match == true {
+				remove = true
+				break
+			}
+		}
+		if remove == false {
+			params = append(params, param)
+		}
+	}
+	if n.SortQuery == true {
+		sort.SliceStable(params, func(i, j int) bool {
+			ni, vi, _ := strings.Cut(params[i], "=")
+			nj, vj, _ := strings.Cut(params[j], "=")
+			if ni != nj {
+				return ni < nj
+			}
+			return vi < vj
+		})
+	}
+	return strings.Join(params, "&")
+}
+
+// RFC 3986 section 5.2.4, keeps trailing slash
+func removeDotSegments(p string) string {
+	if strings.Contains(p, ".") == false {
+		return p
+	}
+	segments := strings.Split(p, "/")
+	var out []string
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last == true {
+				out = append(out, "")
+			}
+		case "..":
+			// never remove the leading empty segment of an absolute path
+			if len(out) > 1 || (len(out) == 1 && out[0] != "") {
+				out = out[:len(out)-1]
+			}
+			if last == true {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(p, "/") && strings.HasPrefix(result, "/") == false {
+		result = "/" + result
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	n := NewNormalizer()
+	checks := map[string]string{
+		"http://Example.com/a/../b#frag":               "http://example.com/b",
+		"HTTPS://example.com:443/b?utm_source=x":       "https://example.com/b",
+		"http://example.com:8080":                      "http://example.com:8080/",
+		"https://example.com/b?z=1&a=2&a=1&fbclid=abc": "https://example.com/b?a=1&a=2&z=1",
+		"https://example.com/./a/./b/../../c/":         "https://example.com/c/",
+		"https://example.com/../../a%2Fb?q=a%20b":      "https://example.com/a%2Fb?q=a%20b",
+		"mailto:someone@example.com":                   "mailto:someone@example.com",
+		"https://example.com/?":                        "https://example.com/",
+	}
+	for in, expected := range checks {
+		out, err := n.Normalize(in)
+		if err != nil || out != expected {
+			t.Errorf("%s: expected %s got %s (%v)", in, expected, out, err)
+		}
+	}
+	n.TrailingSlash = TrailingSlashAdd
+	if out, _ := n.Normalize("https://example.com/a"); out != "https://example.com/a/" {
+		t.Errorf("add: %s", out)
+	}
+	if out, _ := n.Normalize("https://example.com/a.html"); out != "https://example.com/a.html" {
+		t.Errorf("add file: %s", out)
+	}
+	n.TrailingSlash = TrailingSlashRemove
+	if out, _ := n.Normalize("https://example.com/a/"); out != "https://example.com/a" {
+		t.Errorf("remove: %s", out)
+	}
+	if out, _ := n.Normalize("https://example.com/"); out != "https://example.com/" {
+		t.Errorf("remove root: %s", out)
+	}
+}
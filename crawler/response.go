@@ -0,0 +1,148 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// default Crawler.ReportHeaders
+var DefaultReportHeaders = []string{"Cache-Control", "Content-Encoding", "Content-Language", "Content-Length", "Content-Type", "Etag", "Expires", "Last-Modified", "Server", "X-Robots-Tag"}
+
+// timings of the final request made for a URL
+// DNS, Connect and TLS are 0 when a kept-alive connection was reused
+type Timings struct {
+	// DNS lookup
+	DNS time.Duration
+
+	// TCP connect
+	Connect time.Duration
+
+	// TLS handshake
+	TLS time.Duration
+
+	// time to first byte, from sending the request until the first response byte arrived
+	TTFB time.Duration
+
+	// from sending the request until the body was read, or closed unread
+	Total time.Duration
+}
+
+type requestTimerKey struct{}
+
+// collects Timings of a single request from httptrace hooks, which may be called from other goroutines
+type requestTimer struct {
+	mutex        *sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timings      Timings
+}
+
+// returns ctx with httptrace hooks timing the request made with it
+func withRequestTimer(ctx context.Context) context.Context {
+	t := &requestTimer{mutex: &sync.Mutex{}, start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.timings.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			// with several addresses, connects may be attempted in parallel, the first start counts
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_ string, _ string, err error) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			if err == nil {
+				t.timings.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.timings.TLS = time.Since(t.tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			t.timings.TTFB = time.Since(t.start)
+		},
+	}
+	return context.WithValue(httptrace.WithClientTrace(ctx, trace), requestTimerKey{}, t)
+}
+
+// returns the timer set up by withRequestTimer
+func requestTimerFrom(ctx context.Context) *requestTimer {
+	t, _ := ctx.Value(requestTimerKey{}).(*requestTimer)
+	return t
+}
+
+// Fetcher returned a response, counts as the first byte for fetchers which do not fire httptrace hooks
+func (t *requestTimer) responded() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.timings.TTFB == 0 {
+		t.timings.TTFB = time.Since(t.start)
+	}
+}
+
+// returns timings of the request resp answered, with Total up to now, nil if the request was not timed
+func responseTimings(resp *Response) *Timings {
+	if resp == nil || resp.timer == nil {
+		return nil
+	}
+	t := resp.timer
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	timings := t.timings
+	timings.Total = time.Since(t.start)
+	return &timings
+}
+
+// returns the headers listed in names, nil if none of them are present
+func reportHeaders(header http.Header, names []string) (subset http.Header) {
+	for _, name := range names {
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if subset == nil {
+			subset = make(http.Header)
+		}
+		subset[http.CanonicalHeaderKey(name)] = values
+	}
+	return
+}
+
+// response body counting bytes read through it
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return
+}
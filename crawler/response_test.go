@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCrawlWorkResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Server", "test")
+		w.Header().Set("X-Other", "not reported")
+		_, _ = w.Write([]byte("<html><body><a href='/file.zip'>x</a></body></html>"))
+	})
+	mux.HandleFunc("/file.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		_, _ = w.Write(make([]byte, 1000))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	w := newCrawlWorker(context.Background(), c, s.URL+"/page", func(*FoundUrls) {})
+
+	u := w.crawlWork(s.URL+"/page", 1, s.URL+"/")
+	if u.Err != nil || u.StatusCode != 200 || u.Referrer != s.URL+"/" || u.Skipped != "" || len(u.Links) != 1 {
+		t.Errorf("page: %+v", u)
+		t.FailNow()
+	}
+	if u.BytesRead != 51 || u.ContentLength != 51 {
+		t.Errorf("page: read %d of %d bytes", u.BytesRead, u.ContentLength)
+	}
+	if u.Headers.Get("Server") != "test" || u.Headers.Get("X-Other") != "" || u.Headers.Get("Content-Type") != "text/html" {
+		t.Errorf("page headers: %v", u.Headers)
+	}
+	if u.Timings == nil || u.Timings.TTFB <= 0 || u.Timings.Total < u.Timings.TTFB || u.Timings.Connect <= 0 {
+		t.Errorf("page timings: %+v", u.Timings)
+	}
+
+	u = w.crawlWork(s.URL+"/file.zip", 2, s.URL+"/page")
+	if u.Err != nil || u.Skipped != SkippedNotHtml || u.ContentType != "application/zip" || u.ContentLength != 1000 || u.BytesRead != 0 {
+		t.Errorf("zip: %+v", u)
+	}
+}
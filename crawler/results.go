@@ -0,0 +1,34 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+)
+
+// runs the crawl in the background and sends each reported URL on the returned channel, which is closed when the crawl ends
+// the channel holds up to Crawler.ResultsBuffer results, once it is full workers wait for the consumer, so a slow consumer slows the crawl down
+// when ctx is cancelled the crawl stops, results reported after that are dropped unless the consumer is still receiving
+// to stop early, cancel ctx, otherwise workers wait for the consumer forever
+func (c *Crawler) Results(ctx context.Context, baseUrl string) <-chan *FoundUrls {
+	results := make(chan *FoundUrls, c.ResultsBuffer)
+	go func() {
+		defer close(results)
+		_ = c.CrawlContext(ctx, baseUrl, func(u *FoundUrls) {
+			select {
+			case results <- u:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return results
+}
+
+// wraps callbackFunc so only one call runs at a time
+func serializeCallback(callbackFunc func(*FoundUrls)) func(*FoundUrls) {
+	mutex := &sync.Mutex{}
+	return func(u *FoundUrls) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		callbackFunc(u)
+	}
+}
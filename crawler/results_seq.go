@@ -0,0 +1,27 @@
+//go:build go1.23
+
+package crawler
+
+import (
+	"context"
+	"iter"
+)
+
+// same as Results, as an iterator: for u := range c.ResultsSeq(ctx, baseUrl)
+// breaking out of the loop stops the crawl, there is no need to cancel ctx
+func (c *Crawler) ResultsSeq(ctx context.Context, baseUrl string) iter.Seq[*FoundUrls] {
+	return func(yield func(*FoundUrls) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		results := c.Results(ctx, baseUrl)
+		for u := range results {
+			if yield(u) == false {
+				cancel()
+				// wait for the workers to finish, so the crawl is over when the loop is
+				for range results {
+				}
+				return
+			}
+		}
+	}
+}
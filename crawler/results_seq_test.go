@@ -0,0 +1,24 @@
+//go:build go1.23
+
+package crawler
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResultsSeq(t *testing.T) {
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(resultsTestPages(20))
+	count := 0
+	for u := range c.ResultsSeq(context.Background(), "http://a/") {
+		count += 1
+		if u.Depth > 0 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("expected to stop after 2 results, got %d", count)
+	}
+}
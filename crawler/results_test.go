@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// site of n pages, each linking to all others
+func resultsTestPages(n int) map[string]*MemoryPage {
+	var body strings.Builder
+	for i := 0; i < n; i++ {
+		_, _ = fmt.Fprintf(&body, `<a href="/%d">%d</a>`, i, i)
+	}
+	pages := map[string]*MemoryPage{"http://a/": {Body: body.String()}}
+	for i := 0; i < n; i++ {
+		pages[fmt.Sprintf("http://a/%d", i)] = &MemoryPage{Body: body.String()}
+	}
+	return pages
+}
+
+func TestResults(t *testing.T) {
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(resultsTestPages(20))
+	count := 0
+	for range c.Results(context.Background(), "http://a/") {
+		count += 1
+	}
+	if count != 21 {
+		t.Errorf("expected 21 results, got %d", count)
+	}
+
+	// backpressure: while nobody receives, workers wait instead of crawling on
+	var fetched atomic.Int32
+	c.Hooks.OnResponse(func(u *FoundUrls, resp *Response) error {
+		fetched.Add(1)
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	results := c.Results(ctx, "http://a/")
+	<-results
+	time.Sleep(50 * time.Millisecond)
+	if n := fetched.Load(); n > int32(c.Workers)+2 {
+		t.Errorf("crawl did not wait for the consumer: %d pages fetched", n)
+	}
+	cancel()
+	for range results {
+	}
+}
+
+func TestSerializeCallbacks(t *testing.T) {
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(resultsTestPages(20))
+	c.SerializeCallbacks = true
+	var running, overlaps atomic.Int32
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+	})
+	if overlaps.Load() != 0 {
+		t.Errorf("%d overlapping callbacks", overlaps.Load())
+	}
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// which failed requests are retried and how long to sleep in between, see Crawler.RetryPolicy
+// the number of retries is Crawler.Retries, the first backoff is Crawler.SleepBetweenRetries, doubled with each retry
+type RetryPolicy struct {
+	// HTTP status codes which are retried, any other status is final
+	Statuses []int
+
+	// retry requests which timed out
+	Timeouts bool
+
+	// retry other temporary failures: refused or reset connections, temporary DNS failures, connection closed early
+	Temporary bool
+
+	// backoff cap, 0 means no cap
+	MaxDelay time.Duration
+
+	// full jitter: sleep a random duration between 0 and the backoff
+	Jitter bool
+
+	// sleep as long as the Retry-After header of the failed response asks, up to MaxDelay, instead of the backoff
+	RetryAfter bool
+}
+
+// default Crawler.RetryPolicy: 429 and 5xx except 501, timeouts and temporary network errors, never other 4xx
+var DefaultRetryPolicy = RetryPolicy{
+	Statuses:   []int{429, 500, 502, 503, 504},
+	Timeouts:   true,
+	Temporary:  true,
+	MaxDelay:   30 * time.Second,
+	Jitter:     true,
+	RetryAfter: true,
+}
+
+// is the failed request worth retrying
+func (p *RetryPolicy) retryable(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		for _, status := range p.Statuses {
+			if status == statusErr.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		if fetchErr.Timeout() == true {
+			return p.Timeouts
+		}
+		return p.Temporary == true && fetchErr.Temporary() == true
+	}
+	return false
+}
+
+// sleep before retry number retry (counting from 0), base is the first backoff
+// resp is the failed response, if there was one, for Retry-After
+func (p *RetryPolicy) delay(base time.Duration, retry int, resp *Response) (d time.Duration) {
+	if p.RetryAfter == true && resp != nil {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok == true {
+			if p.MaxDelay > 0 && after > p.MaxDelay {
+				after = p.MaxDelay
+			}
+			return after
+		}
+	}
+	d = base
+	for i := 0; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter == true && d > 0 {
+		d = time.Duration(rand.Int63n(int64(d) + 1))
+	}
+	return
+}
+
+// parses Retry-After value, either seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (after time.Duration, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	after = date.Sub(now)
+	if after < 0 {
+		after = 0
+	}
+	return after, true
+}
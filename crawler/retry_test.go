@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := DefaultRetryPolicy
+	checks := map[error]bool{
+		&HTTPStatusError{StatusCode: 503}:                     true,
+		&HTTPStatusError{StatusCode: 429}:                     true,
+		&HTTPStatusError{StatusCode: 404}:                     false,
+		&HTTPStatusError{StatusCode: 501}:                     false,
+		&FetchError{Op: "http.Do", Err: syscall.ECONNRESET}:   true,
+		&FetchError{Op: "hostLimiter", Err: context.Canceled}: false,
+		&HashLoopError{}:                                      false,
+	}
+	for err, expected := range checks {
+		if p.retryable(err) != expected {
+			t.Errorf("%s: expected retryable %v", err, expected)
+		}
+	}
+
+	p.Jitter = false
+	p.MaxDelay = time.Second
+	for retry, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if d := p.delay(100*time.Millisecond, retry, nil); d != expected {
+			t.Errorf("retry %d: expected %s got %s", retry, expected, d)
+		}
+	}
+	p.Jitter = true
+	for i := 0; i < 100; i++ {
+		if d := p.delay(100*time.Millisecond, 2, nil); d < 0 || d > 400*time.Millisecond {
+			t.Errorf("jitter: %s out of range", d)
+		}
+	}
+	resp := &Response{Header: http.Header{"Retry-After": []string{"120"}}}
+	if d := p.delay(0, 0, resp); d != time.Second {
+		t.Errorf("Retry-After capped: %s", d)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if d, ok := parseRetryAfter("Mon, 01 Jan 2024 00:00:30 GMT", now); ok == false || d != 30*time.Second {
+		t.Errorf("Retry-After date: %s %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok == true {
+		t.Errorf("Retry-After invalid: expected not ok")
+	}
+}
+
+func TestCrawlWorkRetry(t *testing.T) {
+	var flaky atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if flaky.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(503)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Retries = 3
+	c.SleepBetweenRetries = time.Millisecond
+	w := newCrawlWorker(context.Background(), c, s.URL+"/", func(*FoundUrls) {})
+
+	u := w.crawlWork(s.URL+"/flaky", 0, "")
+	if u.Err != nil || u.StatusCode != 200 || u.Attempts != 3 {
+		t.Errorf("flaky: %v %d attempts %d", u.Err, u.StatusCode, u.Attempts)
+	}
+	u = w.crawlWork(s.URL+"/missing", 0, "")
+	if u.StatusCode != 404 || u.Attempts != 1 {
+		t.Errorf("missing: %v %d attempts %d", u.Err, u.StatusCode, u.Attempts)
+	}
+}
@@ -0,0 +1,278 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// single Allow/Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// rules from robots.txt applying to our user agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	sitemaps   []string
+}
+
+// rules which allow everything, used when robots.txt is missing
+var robotsAllowAll = &robotsRules{}
+
+// rules which disallow everything, used when robots.txt fetch returned 5xx
+var robotsDisallowAll = &robotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}
+
+// how long robotsDisallowAll is kept after a 5xx, robots.txt is fetched again after that
+var robotsServerErrorTTL = time.Minute
+
+// parses robots.txt, returning the rules of the group matching userAgent
+// the group with the longest user-agent value contained in our product token wins, "*" is the fallback
+// groups with the same user-agent are merged, Sitemap lines are collected regardless of group
+func parseRobots(body io.Reader, userAgent string) (r *robotsRules) {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	r = new(robotsRules)
+	var groupAgents []string
+	var inRules bool
+	best := -1
+	bestRules := make(map[int]*robotsRules)
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		val := strings.TrimSpace(kv[1])
+		switch key {
+		case "user-agent":
+			// user-agent after rules starts a new group
+			if inRules == true {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(val))
+		case "allow", "disallow", "crawl-delay":
+			inRules = true
+			for _, agent := range groupAgents {
+				score := -1
+				if agent == "*" {
+					score = 0
+				} else if agent != "" && strings.Contains(token, agent) {
+					score = len(agent)
+				}
+				if score < 0 {
+					continue
+				}
+				if score > best {
+					best = score
+				}
+				if bestRules[score] == nil {
+					bestRules[score] = new(robotsRules)
+				}
+				g := bestRules[score]
+				switch key {
+				case "crawl-delay":
+					if d, err := strconv.ParseFloat(val, 64); err == nil && d > 0 {
+						g.crawlDelay = time.Duration(d * float64(time.Second))
+					}
+				default:
+					// empty Disallow means allow everything, nothing to add
+					if val != "" {
+						g.rules = append(g.rules, robotsRule{allow: key == "allow", pattern: val})
+					}
+				}
+			}
+		case "sitemap":
+			if val != "" {
+				r.sitemaps = append(r.sitemaps, val)
+			}
+		}
+	}
+	if best >= 0 {
+		r.rules = bestRules[best].rules
+		r.crawlDelay = bestRules[best].crawlDelay
+	}
+	return
+}
+
+// checks if path (with query) may be crawled: the longest matching pattern wins, Allow wins a tie
+func (r *robotsRules) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	allowed := true
+	matchLen := -1
+	for _, rule := range r.rules {
+		if robotsMatch(rule.pattern, path) == false {
+			continue
+		}
+		if len(rule.pattern) > matchLen || (len(rule.pattern) == matchLen && rule.allow == true) {
+			matchLen = len(rule.pattern)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// matches robots.txt pattern against path, '*' matches any sequence, '$' at the end anchors the match
+func robotsMatch(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored == true {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	if strings.HasPrefix(path, parts[0]) == false {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		// last part of an anchored pattern must match at the very end
+		if anchored == true && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return anchored == false || pos == len(path)
+}
+
+// robots.txt for a single host, fetched once, or again once expires has passed
+type robotsHost struct {
+	fetchMutex *sync.Mutex
+	rules      *robotsRules
+	expires    time.Time
+	mutex      *sync.Mutex
+	nextFetch  time.Time
+}
+
+// per-host robots.txt cache of a crawl
+type robotsCache struct {
+	mutex *sync.Mutex
+	hosts map[string]*robotsHost
+}
+
+func newRobotsCache() (c *robotsCache) {
+	c = new(robotsCache)
+	c.mutex = &sync.Mutex{}
+	c.hosts = make(map[string]*robotsHost)
+	return
+}
+
+// returns cache entry and rules for scheme://host of u, fetching robots.txt with fetch on first use, or once the rules expired
+// fetch returns the rules and how long they are valid, 0 meaning for the whole crawl
+// first is true only for the call that did the fetch
+func (c *robotsCache) get(u *url.URL, fetch func(robotsUrl string) (*robotsRules, time.Duration)) (h *robotsHost, rules *robotsRules, first bool) {
+	key := u.Scheme + "://" + u.Host
+	c.mutex.Lock()
+	h = c.hosts[key]
+	if h == nil {
+		h = &robotsHost{fetchMutex: &sync.Mutex{}, mutex: &sync.Mutex{}}
+		c.hosts[key] = h
+	}
+	c.mutex.Unlock()
+	h.fetchMutex.Lock()
+	defer h.fetchMutex.Unlock()
+	if h.rules == nil || (h.expires.IsZero() == false && time.Now().After(h.expires)) {
+		first = true
+		var ttl time.Duration
+		h.rules, ttl = fetch(key + "/robots.txt")
+		h.expires = time.Time{}
+		if ttl > 0 {
+			h.expires = time.Now().Add(ttl)
+		}
+	}
+	rules = h.rules
+	return
+}
+
+// waits until Crawl-delay of rules since the last request to this host has passed
+func (h *robotsHost) wait(ctx context.Context, rules *robotsRules) {
+	if rules.crawlDelay <= 0 {
+		return
+	}
+	h.mutex.Lock()
+	now := time.Now()
+	next := h.nextFetch
+	if next.Before(now) {
+		next = now
+	}
+	h.nextFetch = next.Add(rules.crawlDelay)
+	h.mutex.Unlock()
+	select {
+	case <-time.After(next.Sub(now)):
+	case <-ctx.Done():
+	}
+}
+
+// fetches and parses robots.txt, following up to 5 redirects, retrying according to Crawler.RetryPolicy
+// 4xx means no restrictions, 5xx means crawl nothing on this host for robotsServerErrorTTL, then ask again
+// network errors also mean no restrictions, so the error is reported when fetching the URL itself
+func (w *crawlWorker) fetchRobots(robotsUrl string) (*robotsRules, time.Duration) {
+	userAgent := "Go-http-client"
+	if w.crawler.UserAgent != nil {
+		userAgent = *w.crawler.UserAgent
+	}
+	for hop := 0; hop <= 5; hop++ {
+		resp, _, err := w.crawlWorkGetRetry("GET", robotsUrl)
+		var statusErr *HTTPStatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+			return robotsDisallowAll, robotsServerErrorTTL
+		case err != nil:
+			return robotsAllowAll, 0
+		}
+		if isRedirect(resp) == true {
+			_ = resp.Body.Close()
+			robotsUrl, err = w.crawlWorkParseUrls(robotsUrl, resp.Header.Get("Location"))
+			if err != nil {
+				return robotsAllowAll, 0
+			}
+			continue
+		}
+		defer func() { _ = resp.Body.Close() }()
+		return parseRobots(io.LimitReader(resp.Body, 500*1024), userAgent), 0
+	}
+	return robotsAllowAll, 0
+}
+
+// checks robots.txt for crawlUrl: returns false if disallowed, otherwise waits for Crawl-delay and returns true
+// sitemaps is set to Sitemap URLs from robots.txt for the first URL checked on each host
+func (w *crawlWorker) crawlWorkRobots(crawlUrl string) (allowed bool, sitemaps []*string) {
+	if w.crawler.IgnoreRobots == true {
+		return true, nil
+	}
+	u, err := url.Parse(crawlUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return true, nil
+	}
+	h, rules, first := w.robots.get(u, w.fetchRobots)
+	if first == true {
+		for i := range rules.sitemaps {
+			sitemaps = append(sitemaps, &rules.sitemaps[i])
+		}
+	}
+	if rules.allowed(u.RequestURI()) == false {
+		return false, sitemaps
+	}
+	h.wait(w.ctx, rules)
+	return true, sitemaps
+}
@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	body := `# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public$
+Crawl-delay: 1
+
+User-agent: otherbot
+Disallow: /
+
+User-agent: mybot
+User-agent: somebot
+Disallow: /*.php$
+Allow: /index.php$
+Crawl-delay: 0.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+	r := parseRobots(strings.NewReader(body), "MyBot/1.0")
+	if r.crawlDelay != 500*time.Millisecond || len(r.sitemaps) != 1 || r.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("mybot: %v", r)
+		t.FailNow()
+	}
+	checks := map[string]bool{"/": true, "/private/": true, "/a.php": false, "/a.php?x=1": true, "/index.php": true}
+	for path, allowed := range checks {
+		if r.allowed(path) != allowed {
+			t.Errorf("mybot %s: expected %v", path, allowed)
+		}
+	}
+	r = parseRobots(strings.NewReader(body), "Go-http-client/1.1")
+	checks = map[string]bool{"/": true, "/private/x": false, "/private/public": true, "/private/public/x": false}
+	for path, allowed := range checks {
+		if r.allowed(path) != allowed {
+			t.Errorf("*: %s: expected %v", path, allowed)
+		}
+	}
+}
+
+func TestRobotsDisallowed(t *testing.T) {
+	// disallowed URLs are reported as skipped and never fetched
+	c := NewCrawler()
+	f := &methodFetcher{}
+	f.get = NewMemoryFetcher(map[string]*MemoryPage{
+		"http://a/robots.txt": {Body: "User-agent: *\nDisallow: /private/\n"},
+		"http://a/":           {Body: `<a href="/private/x">x</a><a href="/public">p</a>`},
+		"http://a/private/x":  {Body: `<html></html>`},
+		"http://a/public":     {Body: `<html></html>`},
+	})
+	c.Fetcher = f
+	c.SerializeCallbacks = true
+	reported := make(map[string]*FoundUrls)
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		reported[u.CrawlUrl] = u
+	})
+	if u := reported["http://a/private/x"]; u == nil || u.Skipped != SkippedRobots || u.StatusCode != 0 {
+		t.Errorf("disallowed: %v", u)
+	}
+	if u := reported["http://a/public"]; u == nil || u.StatusCode != 200 {
+		t.Errorf("allowed: %v", u)
+	}
+	for _, request := range f.requests {
+		if request == "GET http://a/private/x" {
+			t.Errorf("disallowed URL fetched: %v", f.requests)
+		}
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	// requests to the host are Crawl-delay apart, even with several workers
+	c := NewCrawler()
+	c.Workers = 4
+	c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{
+		"http://a/robots.txt": {Body: "User-agent: *\nCrawl-delay: 0.05\n"},
+		"http://a/":           {Body: `<a href="/b">b</a><a href="/c">c</a><a href="/d">d</a>`},
+		"http://a/b":          {Body: `<html></html>`},
+		"http://a/c":          {Body: `<html></html>`},
+		"http://a/d":          {Body: `<html></html>`},
+	})
+	start := time.Now()
+	c.Crawl("http://a/", func(u *FoundUrls) {})
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("4 pages with Crawl-delay 50ms took %s", elapsed)
+	}
+}
+
+// serves robots.txt with a 503 the first failures times
+type robotsFailFetcher struct {
+	Fetcher
+	mutex    sync.Mutex
+	failures int
+}
+
+func (f *robotsFailFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (*Response, error) {
+	f.mutex.Lock()
+	fail := strings.HasSuffix(crawlUrl, "/robots.txt") && f.failures > 0
+	if fail == true {
+		f.failures -= 1
+	}
+	f.mutex.Unlock()
+	if fail == true {
+		return &Response{StatusCode: 503, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	return f.Fetcher.Fetch(ctx, method, crawlUrl, header)
+}
+
+func TestRobotsServerError(t *testing.T) {
+	pages := map[string]*MemoryPage{
+		"http://a/robots.txt": {Body: "User-agent: *\nDisallow:\n"},
+		"http://a/":           {Body: `<html></html>`},
+	}
+	// a 5xx on robots.txt is retried according to Crawler.RetryPolicy
+	c := NewCrawler()
+	c.Retries = 1
+	c.Fetcher = &robotsFailFetcher{Fetcher: NewMemoryFetcher(pages), failures: 1}
+	var seed *FoundUrls
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		seed = u
+	})
+	if seed == nil || seed.Skipped != "" || seed.StatusCode != 200 {
+		t.Errorf("retried robots.txt: %v", seed)
+	}
+
+	// without retries the host is disallowed, until robotsServerErrorTTL passes
+	c.Retries = 0
+	c.Fetcher = &robotsFailFetcher{Fetcher: NewMemoryFetcher(pages), failures: 1}
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		seed = u
+	})
+	if seed == nil || seed.Skipped != SkippedRobots {
+		t.Errorf("robots.txt 503: %v", seed)
+	}
+	defer func(ttl time.Duration) { robotsServerErrorTTL = ttl }(robotsServerErrorTTL)
+	robotsServerErrorTTL = 10 * time.Millisecond
+	c.Fetcher = &robotsFailFetcher{Fetcher: NewMemoryFetcher(pages), failures: 1}
+	w := newCrawlWorker(context.Background(), c, "http://a/", func(*FoundUrls) {})
+	if allowed, _ := w.crawlWorkRobots("http://a/"); allowed == true {
+		t.Errorf("allowed right after the 503")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if allowed, _ := w.crawlWorkRobots("http://a/"); allowed == false {
+		t.Errorf("still disallowed after robotsServerErrorTTL")
+	}
+}
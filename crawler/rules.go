@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// include or exclude rule, see Crawler.Rules
+type UrlRule struct {
+	// true to include matching URLs, false to exclude them
+	Include bool
+
+	// rule as written, reported in Link.FilterRule
+	Pattern string
+
+	// matched against the whole absolute URL
+	Match *regexp.Regexp
+}
+
+// creates rule from a regular expression, which may match anywhere in the URL unless anchored
+func NewRegexRule(include bool, pattern string) (r *UrlRule, err error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &UrlRule{Include: include, Pattern: "regex:" + pattern, Match: re}, nil
+}
+
+// creates rule from a glob matched against the whole URL: '*' matches any characters, '?' a single one
+func NewGlobRule(include bool, pattern string) (r *UrlRule, err error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, ch := range pattern {
+		switch ch {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	return &UrlRule{Include: include, Pattern: "glob:" + pattern, Match: re}, nil
+}
+
+// creates rule from "glob:pattern" or "regex:pattern", no prefix means regex
+func NewRule(include bool, pattern string) (r *UrlRule, err error) {
+	if strings.HasPrefix(pattern, "glob:") {
+		return NewGlobRule(include, strings.TrimPrefix(pattern, "glob:"))
+	}
+	return NewRegexRule(include, strings.TrimPrefix(pattern, "regex:"))
+}
+
+// reads rules, one per line as "include pattern" or "exclude pattern", pattern as in NewRule
+// empty lines and lines starting with '#' are ignored
+func ParseRules(body io.Reader) (rules []*UrlRule, err error) {
+	scanner := bufio.NewScanner(body)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		action, pattern, _ := strings.Cut(line, " ")
+		pattern = strings.TrimSpace(pattern)
+		if (action != "include" && action != "exclude") || pattern == "" {
+			return nil, makeError("line %d: expected include|exclude pattern", lineNo)
+		}
+		rule, errR := NewRule(action == "include", pattern)
+		if errR != nil {
+			return nil, makeError("line %d: %s", lineNo, errR)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// applies rules in order, the first matching rule decides
+// a URL matching no rule is excluded only if there are include rules, rule is then empty
+func filterUrl(rules []*UrlRule, url string) (filtered bool, rule string) {
+	hasInclude := false
+	for _, r := range rules {
+		if r.Match.MatchString(url) {
+			if r.Include == true {
+				return false, ""
+			}
+			return true, r.Pattern
+		}
+		if r.Include == true {
+			hasInclude = true
+		}
+	}
+	return hasInclude, ""
+}
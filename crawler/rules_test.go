@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	body := `# skip these
+exclude /logout
+exclude regex:/calendar/\?month=
+exclude glob:*.zip
+include glob:https://example.com/docs/*
+`
+	rules, err := ParseRules(strings.NewReader(body))
+	if err != nil || len(rules) != 4 {
+		t.Errorf("ParseRules: %v %v", rules, err)
+		t.FailNow()
+	}
+	checks := map[string]string{
+		"https://example.com/docs/a":                 "",
+		"https://example.com/docs/logout":            "regex:/logout",
+		"https://example.com/docs/calendar/?month=1": "regex:/calendar/\\?month=",
+		"https://example.com/docs/a.zip":             "glob:*.zip",
+		"https://example.com/blog/":                  "",
+	}
+	for u, rule := range checks {
+		filtered, r := filterUrl(rules, u)
+		if r != rule || filtered != (rule != "" || strings.Contains(u, "/blog/")) {
+			t.Errorf("%s: expected %s got %v %s", u, rule, filtered, r)
+		}
+	}
+	if filtered, _ := filterUrl(rules[:3], "https://example.com/blog/"); filtered == true {
+		t.Errorf("no include rules: expected not filtered")
+	}
+	if _, err = ParseRules(strings.NewReader("skip /x\n")); err == nil {
+		t.Errorf("expected error for unknown action")
+	}
+}
@@ -0,0 +1,216 @@
+package crawler
+
+import (
+	"golang.org/x/net/publicsuffix"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// which hosts are within the crawl scope, relative to the seed URL
+type ScopeMode int
+
+const (
+	// same host as the seed, path under the seed's path, or its directory for a single file (or Scope.PathPrefix), compared on whole segments
+	ScopePrefix ScopeMode = iota
+	// same host as the seed, any path
+	ScopeHost
+	// seed host and any of its subdomains
+	ScopeSubdomains
+	// same registrable domain as the seed, public suffix aware: a.example.co.uk and b.example.co.uk, but not other.co.uk
+	ScopeDomain
+	// any http or https URL
+	ScopeAll
+)
+
+// values of Link.ScopeReason, why a link is (or is not) in scope
+const (
+	// in scope according to Scope.Mode
+	ScopeMatched = "matched"
+	// in scope, host is in Scope.AllowHosts
+	ScopeAllowedHost = "allowed-host"
+	// out of scope, host is in Scope.DenyHosts
+	ScopeDeniedHost = "denied-host"
+	// out of scope, not http or https (or file for a local seed), or scheme differs from the seed's without Scope.AnyScheme
+	ScopeOtherScheme = "other-scheme"
+	// out of scope, host does not match Scope.Mode
+	ScopeOtherHost = "other-host"
+	// out of scope, path does not start with the path prefix
+	ScopeOtherPath = "other-path"
+)
+
+// crawl scope: which found links are crawled, the rest are reported but not followed
+type Scope struct {
+	// how the host of a link is compared to the seed's
+	Mode ScopeMode
+
+	// path in scope URLs must be at or below, compared on whole segments of the escaped path
+	// empty means the seed's path with ScopePrefix, or its directory if the seed is a single file, any path with other modes; ignored with ScopeAll
+	PathPrefix string
+
+	// http and https are equivalent, otherwise the scheme must be the seed's
+	AnyScheme bool
+
+	// "www." in front of a host name is ignored when comparing hosts
+	IgnoreWww bool
+
+	// hosts always in scope, unless denied; "*.example.com" matches any subdomain of example.com, but not example.com
+	AllowHosts []string
+
+	// hosts never in scope, same patterns as AllowHosts, wins over everything else
+	DenyHosts []string
+}
+
+// creates Scope with the same host and path prefix as the seed, scheme must match, www is significant
+func NewScope() (s *Scope) {
+	s = new(Scope)
+	s.Mode = ScopePrefix
+	s.PathPrefix = ""
+	s.AnyScheme = false
+	s.IgnoreWww = false
+	s.AllowHosts = nil
+	s.DenyHosts = nil
+	return
+}
+
+// scope resolved against the seed URL of a crawl
+type scopeChecker struct {
+	scope      *Scope
+	mode       ScopeMode
+	scheme     string
+	host       string
+	hostname   string
+	domain     string
+	pathPrefix string
+}
+
+// resolves s against seed URL baseUrl, followExternal overrides Mode with ScopeAll
+func newScopeChecker(s *Scope, baseUrl string, followExternal bool) (c *scopeChecker) {
+	if s == nil {
+		s = NewScope()
+	}
+	c = new(scopeChecker)
+	c.scope = s
+	c.mode = s.Mode
+	if followExternal == true {
+		c.mode = ScopeAll
+	}
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		u = new(url.URL)
+	}
+	c.scheme = strings.ToLower(u.Scheme)
+	c.host = c.stripWww(strings.ToLower(u.Host))
+	c.hostname = c.stripWww(strings.ToLower(u.Hostname()))
+	c.domain = registrableDomain(c.hostname)
+	c.pathPrefix = s.PathPrefix
+	if c.pathPrefix == "" && c.mode == ScopePrefix {
+		c.pathPrefix = seedPathPrefix(u)
+	}
+	if c.mode == ScopeAll {
+		c.pathPrefix = ""
+	}
+	return
+}
+
+func (c *scopeChecker) stripWww(host string) string {
+	if c.scope.IgnoreWww == true {
+		return strings.TrimPrefix(host, "www.")
+	}
+	return host
+}
+
+// decides if rawUrl is in scope, reason is one of Scope* reason constants
+func (c *scopeChecker) check(rawUrl string) (in bool, reason string) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return false, ScopeOtherScheme
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" && (scheme != "file" || c.scheme != "file") {
+		return false, ScopeOtherScheme
+	}
+	hostname := strings.ToLower(u.Hostname())
+	if matchHosts(c.scope.DenyHosts, hostname) == true {
+		return false, ScopeDeniedHost
+	}
+	if matchHosts(c.scope.AllowHosts, hostname) == true {
+		return true, ScopeAllowedHost
+	}
+	if c.mode == ScopeAll {
+		return true, ScopeMatched
+	}
+	if c.scope.AnyScheme == false && scheme != c.scheme {
+		return false, ScopeOtherScheme
+	}
+	hostname = c.stripWww(hostname)
+	switch c.mode {
+	case ScopeSubdomains:
+		if hostname != c.hostname && strings.HasSuffix(hostname, "."+c.hostname) == false {
+			return false, ScopeOtherHost
+		}
+	case ScopeDomain:
+		if registrableDomain(hostname) != c.domain {
+			return false, ScopeOtherHost
+		}
+	default:
+		if c.stripWww(strings.ToLower(u.Host)) != c.host {
+			return false, ScopeOtherHost
+		}
+	}
+	if matchPathPrefix(u.EscapedPath(), c.pathPrefix) == false {
+		return false, ScopeOtherPath
+	}
+	return true, ScopeMatched
+}
+
+// default path prefix of ScopePrefix: path of the seed u, or its directory if the seed is a single file,
+// i.e. a file:// URL not ending in "/", or a last segment with an extension, such as /docs/index.html
+func seedPathPrefix(u *url.URL) string {
+	p := u.EscapedPath()
+	i := strings.LastIndex(p, "/")
+	if i < 0 || i == len(p)-1 {
+		return p
+	}
+	if strings.ToLower(u.Scheme) == "file" || strings.Contains(p[i+1:], ".") == true {
+		return p[:i+1]
+	}
+	return p
+}
+
+// true if path is prefix or below it, compared on whole segments: "/docs" matches "/docs/a" but not "/docsx"
+func matchPathPrefix(path string, prefix string) bool {
+	// "https://example.com" has an empty path, same as "/"
+	if path == "" {
+		path = "/"
+	}
+	if prefix == "" {
+		return true
+	}
+	if strings.HasSuffix(prefix, "/") == false {
+		if path == prefix {
+			return true
+		}
+		prefix += "/"
+	}
+	return strings.HasPrefix(path, prefix)
+}
+
+// eTLD+1 of hostname, or hostname itself for IP addresses, localhost and such
+func registrableDomain(hostname string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(hostname)
+	if err != nil {
+		return hostname
+	}
+	return domain
+}
+
+// checks hostname against host patterns, see Scope.AllowHosts
+func matchHosts(patterns []string, hostname string) bool {
+	for _, pattern := range patterns {
+		if match, _ := path.Match(strings.ToLower(pattern), hostname); match == true {
+			return true
+		}
+	}
+	return false
+}
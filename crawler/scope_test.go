@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	s := NewScope()
+	c := newScopeChecker(s, "https://example.com/docs/", false)
+	checks := map[string]string{
+		"https://example.com/docs/a":          ScopeMatched,
+		"https://example.com/blog/":           ScopeOtherPath,
+		"https://example.com.evil.org/docs/a": ScopeOtherHost,
+		"https://www.example.com/docs/a":      ScopeOtherHost,
+		"http://example.com/docs/a":           ScopeOtherScheme,
+		"mailto:someone@example.com":          ScopeOtherScheme,
+	}
+	for u, expected := range checks {
+		if in, reason := c.check(u); reason != expected || in != (expected == ScopeMatched) {
+			t.Errorf("prefix %s: expected %s got %v %s", u, expected, in, reason)
+		}
+	}
+
+	// a single file seed is scoped to its directory, a path without extension to itself
+	prefixes := map[string]string{
+		"file:///site/public/index.html": "/site/public/",
+		"file:///site/public/":           "/site/public/",
+		"https://example.com/dir/a.html": "/dir/",
+		"https://example.com/dir/page":   "/dir/page",
+		"https://example.com":            "",
+	}
+	for seed, expected := range prefixes {
+		if c = newScopeChecker(NewScope(), seed, false); c.pathPrefix != expected {
+			t.Errorf("prefix of %s: expected %q got %q", seed, expected, c.pathPrefix)
+		}
+	}
+	c = newScopeChecker(NewScope(), "file:///site/public/index.html", false)
+	if in, _ := c.check("file:///site/public/about/index.html"); in == false {
+		t.Errorf("sibling of a file seed out of scope")
+	}
+
+	s.Mode = ScopeHost
+	s.AnyScheme = true
+	s.IgnoreWww = true
+	s.DenyHosts = []string{"*.example.com"}
+	s.AllowHosts = []string{"cdn.example.net", "static.example.com"}
+	c = newScopeChecker(s, "https://www.example.com/docs/", false)
+	checks = map[string]string{
+		"http://example.com/blog/":        ScopeMatched,
+		"https://www.example.com":         ScopeDeniedHost,
+		"https://cdn.example.net/a.js":    ScopeAllowedHost,
+		"https://static.example.com/a.js": ScopeDeniedHost,
+		"https://example.com:8443/":       ScopeOtherHost,
+		"https://other.example.net/a.js":  ScopeOtherHost,
+	}
+	for u, expected := range checks {
+		if in, reason := c.check(u); reason != expected || in != (expected == ScopeMatched || expected == ScopeAllowedHost) {
+			t.Errorf("host %s: expected %s got %v %s", u, expected, in, reason)
+		}
+	}
+
+	s = NewScope()
+	s.Mode = ScopeSubdomains
+	c = newScopeChecker(s, "https://example.co.uk", false)
+	checks = map[string]string{
+		"https://example.co.uk/a":    ScopeMatched,
+		"https://a.b.example.co.uk/": ScopeMatched,
+		"https://other.co.uk/":       ScopeOtherHost,
+		"https://badexample.co.uk/":  ScopeOtherHost,
+	}
+	for u, expected := range checks {
+		if _, reason := c.check(u); reason != expected {
+			t.Errorf("subdomains %s: expected %s got %s", u, expected, reason)
+		}
+	}
+
+	s.Mode = ScopeDomain
+	c = newScopeChecker(s, "https://www.example.co.uk", false)
+	checks = map[string]string{
+		"https://shop.example.co.uk/": ScopeMatched,
+		"https://other.co.uk/":        ScopeOtherHost,
+		"https://example.com/":        ScopeOtherHost,
+	}
+	for u, expected := range checks {
+		if _, reason := c.check(u); reason != expected {
+			t.Errorf("domain %s: expected %s got %s", u, expected, reason)
+		}
+	}
+
+	// prefix without a trailing slash matches whole segments only
+	c = newScopeChecker(NewScope(), "https://example.com/docs", false)
+	checks = map[string]string{
+		"https://example.com/docs":      ScopeMatched,
+		"https://example.com/docs/":     ScopeMatched,
+		"https://example.com/docs/a":    ScopeMatched,
+		"https://example.com/docs-old/": ScopeOtherPath,
+		"https://example.com/docsx":     ScopeOtherPath,
+	}
+	for u, expected := range checks {
+		if in, reason := c.check(u); reason != expected || in != (expected == ScopeMatched) {
+			t.Errorf("segment prefix %s: expected %s got %v %s", u, expected, in, reason)
+		}
+	}
+
+	c = newScopeChecker(NewScope(), "https://example.com", true)
+	if in, _ := c.check("http://example.org/x"); in == false {
+		t.Errorf("follow external: expected in scope")
+	}
+}
@@ -0,0 +1,387 @@
+package crawler
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SeenStore keeps track of URLs already queued for crawling, so each URL is only crawled once
+// implementations must be safe for concurrent use
+type SeenStore interface {
+	// add URL to the store, returns true if it was not in the store before
+	Add(url string) (added bool, err error)
+
+	// release any resources held by the store
+	Close() error
+}
+
+// SeenStore which can be saved in a checkpoint and restored from it, see Crawler.Checkpoint
+// all built-in stores implement it, Load replaces the contents of the store with the saved ones
+type CheckpointSeenStore interface {
+	SeenStore
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// first line of a saved store, so a checkpoint is only loaded into the kind of store which saved it
+func readSeenHeader(r *bufio.Reader, kind string) (err error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return makeError("read seen store: %s", err)
+	}
+	if strings.TrimSuffix(line, "\n") != kind {
+		return makeError("checkpoint holds %s seen store, not %s", strings.TrimSuffix(line, "\n"), kind)
+	}
+	return
+}
+
+// in-memory hash set, exact, default store
+type memorySeenStore struct {
+	mutex *sync.Mutex
+	urls  map[string]struct{}
+}
+
+// creates a SeenStore backed by an in-memory hash set
+func NewMemorySeenStore() SeenStore {
+	s := new(memorySeenStore)
+	s.mutex = &sync.Mutex{}
+	s.urls = make(map[string]struct{})
+	return s
+}
+
+func (s *memorySeenStore) Add(url string) (added bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.urls[url]; ok {
+		return false, nil
+	}
+	s.urls[url] = struct{}{}
+	return true, nil
+}
+
+func (s *memorySeenStore) Close() error {
+	return nil
+}
+
+// writes one quoted URL per line
+func (s *memorySeenStore) Save(w io.Writer) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString("memory\n")
+	for url := range s.urls {
+		_, _ = bw.WriteString(strconv.Quote(url))
+		_ = bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func (s *memorySeenStore) Load(r io.Reader) (err error) {
+	br := bufio.NewReader(r)
+	err = readSeenHeader(br, "memory")
+	if err != nil {
+		return
+	}
+	urls := make(map[string]struct{})
+	for {
+		line, errR := br.ReadString('\n')
+		if errR == io.EOF && line == "" {
+			break
+		}
+		if errR != nil {
+			return makeError("read seen store: %s", errR)
+		}
+		url, errU := strconv.Unquote(strings.TrimSuffix(line, "\n"))
+		if errU != nil {
+			return makeError("read seen store: %s", errU)
+		}
+		urls[url] = struct{}{}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.urls = urls
+	return
+}
+
+// bloom filter, fixed memory, may report a URL as seen when it was not (false positive), never the other way round
+type bloomSeenStore struct {
+	mutex *sync.Mutex
+	bits  []uint64
+	m     uint64
+	k     uint64
+}
+
+// creates a SeenStore backed by a bloom filter using at most maxBytes of memory
+// expectedUrls is used to pick the number of hash functions, the false positive rate grows once it is exceeded
+func NewBloomSeenStore(maxBytes int, expectedUrls int) SeenStore {
+	if maxBytes < 8 {
+		maxBytes = 8
+	}
+	if expectedUrls < 1 {
+		expectedUrls = 1
+	}
+	s := new(bloomSeenStore)
+	s.mutex = &sync.Mutex{}
+	s.bits = make([]uint64, maxBytes/8)
+	s.m = uint64(len(s.bits)) * 64
+	k := math.Round(float64(s.m) / float64(expectedUrls) * math.Ln2)
+	s.k = uint64(math.Max(1, math.Min(16, k)))
+	return s
+}
+
+func (s *bloomSeenStore) Add(url string) (added bool, err error) {
+	sum := sha256.Sum256([]byte(url))
+	h1 := binary.LittleEndian.Uint64(sum[:8])
+	h2 := binary.LittleEndian.Uint64(sum[8:]) | 1
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := uint64(0); i < s.k; i++ {
+		bit := (h1 + i*h2) % s.m
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			added = true
+			s.bits[bit/64] |= 1 << (bit % 64)
+		}
+	}
+	return
+}
+
+func (s *bloomSeenStore) Close() error {
+	return nil
+}
+
+// writes k and the bit array, the filter size is taken from the saved one on Load
+func (s *bloomSeenStore) Save(w io.Writer) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString("bloom\n")
+	_ = binary.Write(bw, binary.LittleEndian, s.k)
+	_ = binary.Write(bw, binary.LittleEndian, uint64(len(s.bits)))
+	_ = binary.Write(bw, binary.LittleEndian, s.bits)
+	return bw.Flush()
+}
+
+func (s *bloomSeenStore) Load(r io.Reader) (err error) {
+	br := bufio.NewReader(r)
+	err = readSeenHeader(br, "bloom")
+	if err != nil {
+		return
+	}
+	var k, words uint64
+	err = binary.Read(br, binary.LittleEndian, &k)
+	if err == nil {
+		err = binary.Read(br, binary.LittleEndian, &words)
+	}
+	if err != nil || words == 0 || words > math.MaxInt32 {
+		return makeError("read seen store: invalid bloom filter: %v", err)
+	}
+	bits := make([]uint64, words)
+	err = binary.Read(br, binary.LittleEndian, bits)
+	if err != nil {
+		return makeError("read seen store: %s", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.bits = bits
+	s.m = words * 64
+	s.k = k
+	return
+}
+
+// size of a single slot in the on-disk hash table, truncated sha256 of the URL
+const diskSeenSlot = 16
+
+// on-disk open addressing hash table of URL digests, exact up to sha256 collisions, memory use is constant
+type diskSeenStore struct {
+	mutex *sync.Mutex
+	dir   string
+	file  *os.File
+	slots uint64
+	count uint64
+}
+
+// creates a SeenStore backed by a hash table in a temporary file in dir (or the default temp dir if dir is "")
+// the file is removed on Close
+func NewDiskSeenStore(dir string) (SeenStore, error) {
+	s := new(diskSeenStore)
+	s.mutex = &sync.Mutex{}
+	s.dir = dir
+	file, err := s.newTable(1 << 16)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	s.slots = 1 << 16
+	return s, nil
+}
+
+func (s *diskSeenStore) newTable(slots uint64) (file *os.File, err error) {
+	file, err = os.CreateTemp(s.dir, "crawler-seen-*")
+	if err != nil {
+		return nil, makeError("CreateTemp: %s", err)
+	}
+	err = file.Truncate(int64(slots * diskSeenSlot))
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, makeError("Truncate: %s", err)
+	}
+	return
+}
+
+func (s *diskSeenStore) Add(url string) (added bool, err error) {
+	sum := sha256.Sum256([]byte(url))
+	var digest [diskSeenSlot]byte
+	copy(digest[:], sum[:diskSeenSlot])
+	// all-zero slot marks empty
+	if digest == [diskSeenSlot]byte{} {
+		digest[diskSeenSlot-1] = 1
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if (s.count+1)*2 > s.slots {
+		err = s.grow()
+		if err != nil {
+			return
+		}
+	}
+	added, err = s.insert(s.file, s.slots, digest)
+	if added == true {
+		s.count += 1
+	}
+	return
+}
+
+// linear probing insert into table file, returns false if digest already present
+func (s *diskSeenStore) insert(file *os.File, slots uint64, digest [diskSeenSlot]byte) (added bool, err error) {
+	var slot [diskSeenSlot]byte
+	idx := binary.LittleEndian.Uint64(digest[:8]) & (slots - 1)
+	for {
+		_, err = file.ReadAt(slot[:], int64(idx*diskSeenSlot))
+		if err != nil {
+			return false, makeError("ReadAt: %s", err)
+		}
+		if slot == digest {
+			return false, nil
+		}
+		if slot == [diskSeenSlot]byte{} {
+			_, err = file.WriteAt(digest[:], int64(idx*diskSeenSlot))
+			if err != nil {
+				return false, makeError("WriteAt: %s", err)
+			}
+			return true, nil
+		}
+		idx = (idx + 1) & (slots - 1)
+	}
+}
+
+// doubles the table, rehashing all digests into a new file
+func (s *diskSeenStore) grow() (err error) {
+	slots := s.slots * 2
+	file, err := s.newTable(slots)
+	if err != nil {
+		return
+	}
+	buf := make([]byte, diskSeenSlot*4096)
+	for off := int64(0); off < int64(s.slots*diskSeenSlot); off += int64(len(buf)) {
+		n, errR := s.file.ReadAt(buf, off)
+		if errR != nil && errR != io.EOF {
+			err = makeError("ReadAt: %s", errR)
+			break
+		}
+		for i := 0; i+diskSeenSlot <= n; i += diskSeenSlot {
+			var digest [diskSeenSlot]byte
+			copy(digest[:], buf[i:i+diskSeenSlot])
+			if digest == [diskSeenSlot]byte{} {
+				continue
+			}
+			_, err = s.insert(file, slots, digest)
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return
+	}
+	_ = s.file.Close()
+	_ = os.Remove(s.file.Name())
+	s.file = file
+	s.slots = slots
+	return
+}
+
+// writes the table size and the raw table
+func (s *diskSeenStore) Save(w io.Writer) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString("disk\n")
+	_ = binary.Write(bw, binary.LittleEndian, s.slots)
+	_ = binary.Write(bw, binary.LittleEndian, s.count)
+	_, err = io.Copy(bw, io.NewSectionReader(s.file, 0, int64(s.slots*diskSeenSlot)))
+	if err != nil {
+		return makeError("write seen store: %s", err)
+	}
+	return bw.Flush()
+}
+
+// reads the saved table into a new temporary file
+func (s *diskSeenStore) Load(r io.Reader) (err error) {
+	br := bufio.NewReader(r)
+	err = readSeenHeader(br, "disk")
+	if err != nil {
+		return
+	}
+	var slots, count uint64
+	err = binary.Read(br, binary.LittleEndian, &slots)
+	if err == nil {
+		err = binary.Read(br, binary.LittleEndian, &count)
+	}
+	if err != nil || slots == 0 || slots&(slots-1) != 0 {
+		return makeError("read seen store: invalid table: %v", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	file, err := s.newTable(slots)
+	if err != nil {
+		return
+	}
+	_, err = io.CopyN(file, br, int64(slots*diskSeenSlot))
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return makeError("read seen store: %s", err)
+	}
+	_ = s.file.Close()
+	_ = os.Remove(s.file.Name())
+	s.file = file
+	s.slots = slots
+	s.count = count
+	return
+}
+
+func (s *diskSeenStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	err := s.file.Close()
+	s.file = nil
+	_ = os.Remove(name)
+	return err
+}
@@ -0,0 +1,43 @@
+package crawler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testSeenStore(t *testing.T, s SeenStore, count int) {
+	for i := 0; i < count; i++ {
+		added, err := s.Add(fmt.Sprintf("http://example.com/%d", i))
+		if err != nil || added == false {
+			t.Errorf("add %d: %v %s", i, added, err)
+			t.FailNow()
+		}
+	}
+	for i := 0; i < count; i++ {
+		added, err := s.Add(fmt.Sprintf("http://example.com/%d", i))
+		if err != nil || added == true {
+			t.Errorf("re-add %d: %v %s", i, added, err)
+			t.FailNow()
+		}
+	}
+	if s.Close() != nil {
+		t.FailNow()
+	}
+}
+
+func TestMemorySeenStore(t *testing.T) {
+	testSeenStore(t, NewMemorySeenStore(), 1000)
+}
+
+func TestBloomSeenStore(t *testing.T) {
+	testSeenStore(t, NewBloomSeenStore(1024*1024, 1000), 1000)
+}
+
+func TestDiskSeenStore(t *testing.T) {
+	s, err := NewDiskSeenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// enough to force the table to grow
+	testSeenStore(t, s, 40000)
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// settings of the http.Transport shared by all requests of a single crawl, see Crawler.Transport
+// the total timeout, including reading the body, is Crawler.Timeout
+type Transport struct {
+	// max time to establish a TCP connection, 0 == no limit
+	DialTimeout time.Duration
+
+	// max time for the TLS handshake, 0 == no limit
+	TLSHandshakeTimeout time.Duration
+
+	// max time to wait for response headers after the request was sent, 0 == no limit
+	ResponseHeaderTimeout time.Duration
+
+	// TCP keep-alive probe interval, 0 == Go default (15s), negative disables probes
+	KeepAlive time.Duration
+
+	// do not reuse connections, a new one is opened for each request
+	DisableKeepAlives bool
+
+	// max idle connections kept open across all hosts, 0 == no limit
+	MaxIdleConns int
+
+	// max idle connections kept open per host, 0 == Crawler.Workers, so each worker can reuse its connection
+	MaxIdleConnsPerHost int
+
+	// how long an idle connection is kept open, 0 == no limit
+	IdleConnTimeout time.Duration
+}
+
+// default Crawler.Transport
+var DefaultTransport = Transport{
+	DialTimeout:           30 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 0,
+	KeepAlive:             30 * time.Second,
+	DisableKeepAlives:     false,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   0,
+	IdleConnTimeout:       90 * time.Second,
+}
+
+// creates http.Transport from the settings, proxies are taken from the environment as with http.DefaultTransport
+// workers is used for MaxIdleConnsPerHost == 0
+func (t Transport) newTransport(workers int) *http.Transport {
+	idlePerHost := t.MaxIdleConnsPerHost
+	if idlePerHost == 0 {
+		idlePerHost = workers
+	}
+	dialer := &net.Dialer{Timeout: t.DialTimeout, KeepAlive: t.KeepAlive}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   t.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: t.ResponseHeaderTimeout,
+		DisableKeepAlives:     t.DisableKeepAlives,
+		MaxIdleConns:          t.MaxIdleConns,
+		MaxIdleConnsPerHost:   idlePerHost,
+		IdleConnTimeout:       t.IdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// creates the http.Client used for the whole crawl, from Crawler.RoundTripper if set, or from Crawler.Transport
+// closeIdle closes idle connections of a transport created here, once the crawl is done
+func (c *Crawler) newHttpClient() (client *http.Client, closeIdle func()) {
+	client = new(http.Client)
+	client.Timeout = c.Timeout
+	// redirects are handled by crawlWorkFollowRedirects, so they can be reported per hop
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	if c.RoundTripper != nil {
+		client.Transport = c.RoundTripper
+		return client, func() {}
+	}
+	transport := c.Transport.newTransport(c.Workers)
+	client.Transport = transport
+	return client, transport.CloseIdleConnections
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransport(t *testing.T) {
+	transport := DefaultTransport.newTransport(7)
+	if transport.MaxIdleConnsPerHost != 7 || transport.TLSHandshakeTimeout != 10*time.Second || transport.DisableKeepAlives == true {
+		t.Errorf("unexpected transport: %+v", transport)
+	}
+
+	var conns atomic.Int32
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	s.Start()
+	defer s.Close()
+	c := NewCrawler()
+	w := newCrawlWorker(context.Background(), c, s.URL+"/", func(*FoundUrls) {})
+	for i := 0; i < 5; i++ {
+		resp, err := w.doFetch("GET", s.URL+"/")
+		if err != nil {
+			t.Errorf("request %d: %s", i, err)
+			t.FailNow()
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	if conns.Load() != 1 {
+		t.Errorf("expected 1 reused connection, got %d", conns.Load())
+	}
+
+	// user RoundTripper replaces the transport
+	var trips atomic.Int32
+	c.RoundTripper = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		trips.Add(1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	w = newCrawlWorker(context.Background(), c, s.URL+"/", func(*FoundUrls) {})
+	resp, err := w.doFetch("GET", s.URL+"/")
+	if err != nil || trips.Load() != 1 {
+		t.Errorf("RoundTripper: %v, %d trips", err, trips.Load())
+	} else {
+		_ = resp.Body.Close()
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
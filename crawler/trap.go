@@ -0,0 +1,141 @@
+package crawler
+
+import (
+	"hash/fnv"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// crawler trap heuristics, a found link exceeding any limit is reported with Link.Trap set and not fetched
+// 0 means unlimited
+type TrapLimits struct {
+	// max number of path segments, catches ever-growing paths
+	MaxPathDepth int
+
+	// max number of times a segment or group of segments may repeat back to back, catches /a/a/a/a and /a/b/a/b/a/b/a/b
+	// repeats apart from each other are fine, /en/docs/en/api/en is not a trap
+	MaxRepeatedSegments int
+
+	// max number of distinct query strings per scheme://host/path, catches session IDs, calendars and endless pagination
+	MaxQueryVariants int
+
+	// max length of the whole URL
+	MaxUrlLength int
+}
+
+// values of Link.Trap, the TrapLimits rule which caught the URL
+const (
+	TrapPathDepth       = "path-depth"
+	TrapRepeatedSegment = "repeated-segment"
+	TrapQueryVariants   = "query-variants"
+	TrapUrlLength       = "url-length"
+)
+
+// default Crawler.Traps
+var DefaultTrapLimits = TrapLimits{MaxPathDepth: 30, MaxRepeatedSegments: 3, MaxQueryVariants: 1000, MaxUrlLength: 2048}
+
+// applies TrapLimits, remembering query variants seen for each path during the crawl
+type trapDetector struct {
+	limits   TrapLimits
+	mutex    *sync.Mutex
+	variants map[string]map[uint64]struct{}
+}
+
+func newTrapDetector(limits TrapLimits) (d *trapDetector) {
+	d = new(trapDetector)
+	d.limits = limits
+	d.mutex = &sync.Mutex{}
+	d.variants = make(map[string]map[uint64]struct{})
+	return
+}
+
+// returns the rule which caught rawUrl, or empty string if it looks fine
+// the query variant is remembered, checking the same URL again gives the same result
+func (d *trapDetector) check(rawUrl string) (trap string) {
+	if d.limits.MaxUrlLength > 0 && len(rawUrl) > d.limits.MaxUrlLength {
+		return TrapUrlLength
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	var segments []string
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if d.limits.MaxPathDepth > 0 && len(segments) > d.limits.MaxPathDepth {
+		return TrapPathDepth
+	}
+	if d.limits.MaxRepeatedSegments > 0 && maxRepeats(segments) > d.limits.MaxRepeatedSegments {
+		return TrapRepeatedSegment
+	}
+	if d.limits.MaxQueryVariants > 0 && u.RawQuery != "" {
+		key := u.Scheme + "://" + u.Host + u.EscapedPath()
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(u.RawQuery))
+		sum := h.Sum64()
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		seen := d.variants[key]
+		if seen == nil {
+			seen = make(map[uint64]struct{})
+			d.variants[key] = seen
+		}
+		if _, ok := seen[sum]; ok == false {
+			if len(seen) >= d.limits.MaxQueryVariants {
+				return TrapQueryVariants
+			}
+			seen[sum] = struct{}{}
+		}
+	}
+	return ""
+}
+
+// query variants seen per path, for checkpoints
+func (d *trapDetector) saveVariants() (variants map[string][]uint64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	variants = make(map[string][]uint64, len(d.variants))
+	for key, seen := range d.variants {
+		for sum := range seen {
+			variants[key] = append(variants[key], sum)
+		}
+	}
+	return
+}
+
+// restores query variants saved by saveVariants
+func (d *trapDetector) loadVariants(variants map[string][]uint64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for key, sums := range variants {
+		seen := make(map[uint64]struct{}, len(sums))
+		for _, sum := range sums {
+			seen[sum] = struct{}{}
+		}
+		d.variants[key] = seen
+	}
+}
+
+// highest number of back to back repeats of any segment or group of segments, 2 for /x/a/b/a/b
+func maxRepeats(segments []string) (repeats int) {
+	repeats = 1
+	for size := 1; size <= len(segments)/2; size++ {
+		// segments in a row equal to the one size places earlier
+		matched := 0
+		for i := size; i < len(segments); i++ {
+			if segments[i] != segments[i-size] {
+				matched = 0
+				continue
+			}
+			matched += 1
+			if 1+matched/size > repeats {
+				repeats = 1 + matched/size
+			}
+		}
+	}
+	return
+}
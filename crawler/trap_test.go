@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTrapDetector(t *testing.T) {
+	d := newTrapDetector(TrapLimits{MaxPathDepth: 5, MaxRepeatedSegments: 2, MaxQueryVariants: 3, MaxUrlLength: 100})
+	checks := map[string]string{
+		"https://example.com/a/b/c":                         "",
+		"https://example.com/a/b/a/b":                       "",
+		"https://example.com/a/b/a/b/a/b":                   TrapPathDepth,
+		"https://example.com/a/b/a/c/a":                     "",
+		"https://example.com/a/a/a":                         TrapRepeatedSegment,
+		"https://example.com/x/a/b/a/b":                     "",
+		"https://example.com/a?" + strings.Repeat("x", 100): TrapUrlLength,
+	}
+	for u, expected := range checks {
+		if trap := d.check(u); trap != expected {
+			t.Errorf("%s: expected %q got %q", u, expected, trap)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if trap := d.check(fmt.Sprintf("https://example.com/cal?month=%d", i)); trap != "" {
+			t.Errorf("variant %d: unexpected %s", i, trap)
+		}
+	}
+	if trap := d.check("https://example.com/cal?month=3"); trap != TrapQueryVariants {
+		t.Errorf("variant 3: expected %s got %q", TrapQueryVariants, trap)
+	}
+	if trap := d.check("https://example.com/cal?month=1"); trap != "" {
+		t.Errorf("known variant: unexpected %s", trap)
+	}
+	if trap := d.check("https://example.com/other?month=3"); trap != "" {
+		t.Errorf("other path: unexpected %s", trap)
+	}
+	// only back to back repeats count
+	d = newTrapDetector(DefaultTrapLimits)
+	checks = map[string]string{
+		"https://example.com/2024/01/01/01":             "",
+		"https://example.com/en/docs/en/api/en":         "",
+		"https://example.com/a/a/a/a":                   TrapRepeatedSegment,
+		"https://example.com/x/a/b/a/b/a/b/a/b":         TrapRepeatedSegment,
+		"https://example.com/x/a/b/c/a/b/c/a/b/c/y":     "",
+		"https://example.com/x/a/b/c/a/b/c/a/b/c/a/b/c": TrapRepeatedSegment,
+	}
+	for u, expected := range checks {
+		if trap := d.check(u); trap != expected {
+			t.Errorf("%s: expected %q got %q", u, expected, trap)
+		}
+	}
+	d = newTrapDetector(TrapLimits{})
+	if trap := d.check("https://example.com/a/a/a/a/a/a/a/a?" + strings.Repeat("x", 5000)); trap != "" {
+		t.Errorf("no limits: unexpected %s", trap)
+	}
+}
@@ -2,138 +2,409 @@ package crawler
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // crawl worker struct, contains config and all states that are needed by the crawler
 type crawlWorker struct {
+	ctx            context.Context
+	requestCtx     context.Context
 	crawler        *Crawler
 	baseUrl        string
 	callbackFunc   func(*FoundUrls)
-	crawledUrls    []*string
-	mutex          *sync.Mutex
-	crawledUrlHash map[string]*[]byte
+	seen           SeenStore
+	robots         *robotsCache
+	hostLimiter    *hostLimiter
+	scope          *scopeChecker
+	traps          *trapDetector
+	crawledUrlHash map[[sha256.Size]byte]string
 	hashMutex      *sync.Mutex
-	workers        chan int
+	nearDuplicates *nearDuplicates
+	frontier       *frontier
+	siteRoot       *url.URL
+	fetcher        Fetcher
+	closeIdle      func()
+	checkpoint     string
 	workerSync     sync.WaitGroup
+	crawled        atomic.Int64
 }
 
 type crawlWorkerInterface interface {
-	crawl(crawlUrl string, depth int)
-	crawlWork(crawlUrl string, depth int) (u *FoundUrls)
-	doHttpRequest(crawlUrl string) (r *http.Response, err error)
-	addWorker()
-	waitForWorkers()
-    crawlWorkCheckList(crawlUrl string) (doWork bool)
-	crawlWorkGetRetry(crawlUrl string) (resp *http.Response, err error)
-	crawlWorkHashLoopCheck(crawlUrl string, resp *http.Response) (respBody io.Reader, err error)
+	report(u *FoundUrls)
+	crawlWork(crawlUrl string, depth int, referrer string) (u *FoundUrls)
+	doFetch(method string, crawlUrl string) (r *Response, err error)
+	enqueue(crawlUrl string, depth int, referrer string)
+	enqueueCheck(crawlUrl string, depth int, referrer string)
+	startWorkers()
+	waitForWorkers() (err error)
+	crawlWorkCheckList(crawlUrl string, checkOnly bool) (doWork bool, err error)
+	crawlWorkRobots(crawlUrl string) (allowed bool, sitemaps []*string)
+	crawlWorkCheck(crawlUrl string, depth int, referrer string) (u *FoundUrls)
+	crawlWorkResponse(u *FoundUrls, finalUrl string, resp *Response)
+	crawlWorkGetRetry(method string, crawlUrl string) (resp *Response, attempts int, err error)
+	crawlWorkFollowRedirects(crawlUrl string, depth int, method string, checkOnly bool) (resp *Response, finalUrl string, redirects []*Redirect, attempts int, err error)
+	crawlWorkHashLoopCheck(u *FoundUrls, resp *Response) (respBody io.Reader, err error)
 	crawlWorkParseUrls(crawlUrl string, link string) (foundUrl string, err error)
 }
 
-func (w *crawlWorker) addWorker() {
-	w.workers<-1
-	w.workerSync.Add(1)
+// adds URL to the frontier, unless it was already seen; empty crawlUrl at depth 0 means baseUrl
+// dedup happens here, so each URL is only ever queued once, referrer is the page it was first found on
+func (w *crawlWorker) enqueue(crawlUrl string, depth int, referrer string) {
+	if crawlUrl == "" && depth == 0 {
+		crawlUrl = w.baseUrl
+	}
+	crawlUrl, ok := w.enqueueHooks(crawlUrl, depth, referrer, false)
+	if ok == false {
+		return
+	}
+	doWork, err := w.crawlWorkCheckList(crawlUrl, false)
+	if err != nil {
+		w.callbackFunc(&FoundUrls{CrawlUrl: crawlUrl, Depth: depth, Referrer: referrer, Err: err})
+		return
+	}
+	if doWork == false {
+		return
+	}
+	w.frontier.push(crawlJob{Url: crawlUrl, Depth: depth, Referrer: referrer})
+}
+
+// adds URL to the frontier to be checked for existence only, not parsed or crawled further
+// used for links out of scope with Crawler.CheckExternal, only http and https URLs are checked, and file URLs of a local crawl
+func (w *crawlWorker) enqueueCheck(crawlUrl string, depth int, referrer string) {
+	local := w.siteRoot != nil && strings.HasPrefix(crawlUrl, "file:")
+	if strings.HasPrefix(crawlUrl, "http://") == false && strings.HasPrefix(crawlUrl, "https://") == false && local == false {
+		return
+	}
+	crawlUrl, ok := w.enqueueHooks(crawlUrl, depth, referrer, true)
+	if ok == false {
+		return
+	}
+	doWork, err := w.crawlWorkCheckList(crawlUrl, true)
+	if err != nil {
+		w.callbackFunc(&FoundUrls{CrawlUrl: crawlUrl, Depth: depth, Referrer: referrer, Err: err, CheckOnly: true})
+		return
+	}
+	if doWork == false {
+		return
+	}
+	w.frontier.push(crawlJob{Url: crawlUrl, Depth: depth, Referrer: referrer, CheckOnly: true})
 }
 
-func (w *crawlWorker) waitForWorkers() {
+// starts a fixed pool of Crawler.Workers goroutines, each pulling jobs from the frontier until it is drained
+func (w *crawlWorker) startWorkers() {
+	workers := w.crawler.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		w.workerSync.Add(1)
+		go w.runWorker()
+	}
+}
+
+// single worker loop
+// once the context is cancelled, no new job is started, requests in flight finish and are reported as usual
+// a job cut short by the cancel, before its request was sent, is queued again instead of being reported:
+// counted in IncompleteCrawlError.NotCrawled, and with Crawler.Checkpoint saved to be crawled on resume
+func (w *crawlWorker) runWorker() {
+	defer w.workerSync.Done()
+	for {
+		job, ok := w.frontier.pop()
+		if ok == false {
+			return
+		}
+		if w.ctx.Err() != nil {
+			w.frontier.push(job)
+			w.frontier.done()
+			return
+		}
+		var u *FoundUrls
+		if job.CheckOnly == true {
+			u = w.crawlWorkCheck(job.Url, job.Depth, job.Referrer)
+		} else {
+			u = w.crawlWork(job.Url, job.Depth, job.Referrer)
+		}
+		if w.ctx.Err() != nil && errors.Is(u.Err, w.ctx.Err()) == true {
+			w.frontier.push(job)
+		} else {
+			w.report(u)
+			w.crawled.Add(1)
+		}
+		w.frontier.done()
+	}
+}
+
+// waits for the frontier to drain and all workers to exit
+// if the context is cancelled first, stops handing out new jobs, lets in-flight jobs finish and returns IncompleteCrawlError
+// with Crawler.Checkpoint, saves a checkpoint every Crawler.CheckpointInterval, on cancel and when the crawl is finished
+func (w *crawlWorker) waitForWorkers() (err error) {
+	finished := make(chan struct{})
+	stopped := make(chan struct{})
+	var errSave error
+	saved := false
+	go func() {
+		defer close(stopped)
+		// interval is counted from the end of the previous save, so a slow save does not starve the workers
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if w.checkpoint != "" && w.crawler.CheckpointInterval > 0 {
+			timer = time.NewTimer(w.crawler.CheckpointInterval)
+			defer timer.Stop()
+			tick = timer.C
+		}
+		for {
+			select {
+			case <-w.ctx.Done():
+				// in-flight jobs are queued again or reported before the frontier is saved
+				if w.checkpoint != "" {
+					w.frontier.pause()
+					errSave = w.saveCheckpoint()
+					saved = true
+				}
+				w.frontier.close()
+				return
+			case <-tick:
+				w.frontier.pause()
+				errSave = w.saveCheckpoint()
+				w.frontier.resume()
+				timer.Reset(w.crawler.CheckpointInterval)
+			case <-finished:
+				return
+			}
+		}
+	}()
 	w.workerSync.Wait()
+	close(finished)
+	<-stopped
+	if w.checkpoint != "" && saved == false {
+		errSave = w.saveCheckpoint()
+	}
+	w.frontier.close()
+	w.closeIdle()
+	if w.ctx.Err() != nil {
+		err = &IncompleteCrawlError{Err: w.ctx.Err(), Crawled: int(w.crawled.Load()), NotCrawled: w.frontier.droppedCount()}
+	}
+	return errors.Join(err, errSave)
 }
 
 // creates and returns new crawlWorker struct, setting basics in the struct
-func newCrawlWorker(c *Crawler, baseUrl string, callbackFunc func(*FoundUrls)) (w *crawlWorker) {
+func newCrawlWorker(ctx context.Context, c *Crawler, baseUrl string, callbackFunc func(*FoundUrls)) (w *crawlWorker) {
+	return newCrawlWorkerSite(ctx, c, baseUrl, c.SiteRoot, callbackFunc)
+}
+
+// same as newCrawlWorker, with siteRoot instead of Crawler.SiteRoot
+func newCrawlWorkerSite(ctx context.Context, c *Crawler, baseUrl string, siteRoot string, callbackFunc func(*FoundUrls)) (w *crawlWorker) {
 	w = new(crawlWorker)
+	w.ctx = ctx
+	// requests already sent are not aborted by the cancel, only Crawler.Timeout ends them
+	w.requestCtx = context.WithoutCancel(ctx)
 	w.crawler = c
-	w.baseUrl = baseUrl
-	w.callbackFunc = callbackFunc
-	w.mutex = &sync.Mutex{}
+	w.checkpoint = c.Checkpoint
+	w.baseUrl, w.siteRoot = c.startUrl(baseUrl, siteRoot)
+	// error and complete hooks run for every URL reported, whichever way it is reported
+	if c.SerializeCallbacks == true {
+		callbackFunc = serializeCallback(callbackFunc)
+	}
+	w.callbackFunc = func(u *FoundUrls) {
+		c.Hooks.complete(u)
+		callbackFunc(u)
+	}
+	w.seen = c.SeenStore
+	if w.seen == nil {
+		w.seen = NewMemorySeenStore()
+	}
 	w.hashMutex = &sync.Mutex{}
-	w.workers = make(chan int, c.Workers)
-	w.crawledUrlHash = make(map[string]*[]byte)
+	w.robots = newRobotsCache()
+	w.hostLimiter = newHostLimiter(c.HostLimit, c.HostLimits)
+	w.scope = newScopeChecker(c.Scope, w.baseUrl, c.FollowExternal)
+	w.traps = newTrapDetector(c.Traps)
+	w.frontier = newFrontier(c.FrontierMemoryLimit)
+	w.fetcher = c.Fetcher
+	w.closeIdle = func() {}
+	if w.fetcher == nil {
+		var client *http.Client
+		client, w.closeIdle = c.newHttpClient()
+		w.fetcher = NewHTTPFetcher(client)
+		if w.siteRoot != nil {
+			files, _ := NewDirFetcher(filepath.FromSlash(w.siteRoot.Path), w.siteRoot.String())
+			w.fetcher = &fileFetcher{files: files, other: w.fetcher}
+		}
+	}
+	w.crawledUrlHash = make(map[[sha256.Size]byte]string)
+	if c.NearDuplicates == true {
+		w.nearDuplicates = newNearDuplicates(c.NearDuplicateDistance)
+	}
 	return
 }
 
-// crawl: runs the worker, parses the return, calls callback and calls self for each FoundUrl to keep crawling deeper
-func (w *crawlWorker) crawl(crawlUrl string, depth int) {
-	if crawlUrl == "" && depth == 0 {
-		crawlUrl = w.baseUrl
+// runs Crawler.Hooks enqueue hooks, a panicking hook drops the URL, which is reported with the panic
+func (w *crawlWorker) enqueueHooks(crawlUrl string, depth int, referrer string, checkOnly bool) (newUrl string, ok bool) {
+	newUrl, ok, err := w.crawler.Hooks.enqueue(crawlUrl, depth, referrer)
+	if err != nil {
+		w.callbackFunc(&FoundUrls{CrawlUrl: crawlUrl, Depth: depth, Referrer: referrer, Err: err, CheckOnly: checkOnly})
+		return "", false
 	}
-	u := w.crawlWork(crawlUrl, depth)
-	if u != nil {
-		w.callbackFunc(u)
-		if w.crawler.MaxDepth < 0 || depth < w.crawler.MaxDepth {
-			for _, aurl := range u.FoundUrls {
-				if w.crawler.FollowExternal == true || strings.HasPrefix(*aurl, w.baseUrl) {
-					w.addWorker()
-					go w.crawl(*aurl, depth+1)
-				}
+	return
+}
+
+// calls callback with u, then queues each found link, check only URLs have no links
+func (w *crawlWorker) report(u *FoundUrls) {
+	w.callbackFunc(u)
+	// Crawler.MaxDepth limits pages crawled, links of the deepest pages are still checked
+	deepest := w.crawler.MaxDepth >= 0 && u.Depth >= w.crawler.MaxDepth
+	for _, link := range u.Links {
+		if link.Filtered == true || link.Trap != "" {
+			continue
+		}
+		if link.InScope == true && link.Kind == LinkNavigation {
+			if deepest == false {
+				w.enqueue(link.Url, u.Depth+1, u.CrawlUrl)
 			}
+		} else if link.InScope == true || w.crawler.CheckExternal == true {
+			// assets, and external links in check mode, are only checked for existence
+			w.enqueueCheck(link.Url, u.Depth+1, u.CrawlUrl)
 		}
 	}
-	w.workerSync.Done()
-	return
+}
+
+// is the URL within the crawl scope, i.e. should we crawl it, see Crawler.Scope
+func (w *crawlWorker) inScope(aurl string) bool {
+	in, _ := w.scope.check(aurl)
+	return in
+}
+
+// is the URL excluded by Crawler.Rules, i.e. should we skip it even if in scope
+func (w *crawlWorker) filtered(aurl string) bool {
+	filtered, _ := filterUrl(w.crawler.Rules, aurl)
+	return filtered
+}
+
+// sets scope, filter and trap decision of a found link
+// only links which will be fetched count against Crawler.Traps, external links only with Crawler.CheckExternal
+func (w *crawlWorker) checkLink(link *Link) {
+	link.InScope, link.ScopeReason = w.scope.check(link.Url)
+	link.Filtered, link.FilterRule = filterUrl(w.crawler.Rules, link.Url)
+	if link.Filtered == false && (link.InScope == true || w.crawler.CheckExternal == true) {
+		link.Trap = w.traps.check(link.Url)
+	}
 }
 
 // actual crawl worker, crawls the URL, fills the FoundUrls object and returns it
-// may return NIL if output is to be ignored (URL was not text/html for example, or already crawled this URL)
-func (w *crawlWorker) crawlWork(crawlUrl string, depth int) (u *FoundUrls) {
+// URLs which are not text/html are reported with Skipped set to SkippedNotHtml, their body is not read
+func (w *crawlWorker) crawlWork(crawlUrl string, depth int, referrer string) (u *FoundUrls) {
 
 	// always create, set basics
 	u = new(FoundUrls)
 	u.CrawlUrl = crawlUrl
 	u.Depth = depth
+	u.Referrer = referrer
 
-	// signal on chan once we are done
-	defer func() { <-w.workers }()
-
-	// find if we crawled this before, if so exit, if not add to list of 'crawled this'
-	if w.crawlWorkCheckList(crawlUrl) == false {
-		return nil
+	// check robots.txt, skip if disallowed, wait for Crawl-delay otherwise
+	allowed, sitemaps := w.crawlWorkRobots(crawlUrl)
+	u.Sitemaps = sitemaps
+	if allowed == false {
+		u.Skipped = SkippedRobots
+		return
 	}
 
 	// handle HTTP request
-	// handles retries and sleep between retries
-	resp, err := w.crawlWorkGetRetry(crawlUrl)
+	// handles retries and sleep between retries, and redirects according to Crawler.Redirects
+	resp, finalUrl, redirects, attempts, err := w.crawlWorkFollowRedirects(crawlUrl, depth, "GET", false)
+	u.Redirects = redirects
+	u.Attempts = attempts
+	if err != nil {
+		u.Err = err
+		u.setStatusFromError()
+		return
+	}
+	if resp == nil {
+		// redirect recorded but not followed, report target as found link so it is crawled (or checked) if in scope
+		if len(redirects) > 0 {
+			link := &Link{Url: redirects[len(redirects)-1].Location, Kind: LinkNavigation}
+			w.checkLink(link)
+			if w.crawler.Redirects == RedirectRecord || link.InScope == false || link.Filtered == true || link.Trap != "" {
+				u.addLink(link)
+			}
+		}
+		return
+	}
+	body := &countingReader{ReadCloser: resp.Body}
+	resp.Body = body
+	defer func() {
+		_ = resp.Body.Close()
+		u.BytesRead = body.n
+		u.Timings = responseTimings(resp)
+	}()
+	w.crawlWorkResponse(u, finalUrl, resp)
+	err = w.crawler.Hooks.response(u, resp)
 	if err != nil {
 		u.Err = err
 		return
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	// if content-type header exists, and it's NOT text/html, simply return nil, not a HTML file
+	// if content-type header exists, and it's NOT text/html, report it without reading the body, not a HTML file
 	if len(resp.Header["Content-Type"]) > 0 {
 		if strings.HasPrefix(resp.Header["Content-Type"][0], "text/html") == false {
-			return nil
+			u.Skipped = SkippedNotHtml
+			return
 		}
 	}
 
 	// if HashLoopCheck is true, handle checking if hash was already crawled, set error and return if yes
-	// otherwise, add to hash list
-	respBody, err := w.crawlWorkHashLoopCheck(crawlUrl, resp)
+	// otherwise, add to hash list; with NearDuplicates, also find the cluster of similar pages this one belongs to
+	respBody, err := w.crawlWorkHashLoopCheck(u, resp)
 	if err != nil {
 		u.Err = err
 		return
 	}
 
-	// extract '<a href=' links, parrse them and add to list of FoundUrls
-	// here if we have an issue parsing the URL, we will set an error, but will not return without finishing parsing
-	links := extractHref(respBody)
+	// extract links from Crawler.LinkSources, parse them and add to list of FoundUrls
+	// relative links are resolved against <base href> if the page has one, the final URL otherwise
+	// here if we have an issue parsing the URL, we will add it to LinkErrors, but will not return without finishing parsing
+	links, baseHref := extractLinks(respBody, w.crawler.LinkSources)
+	baseUrl := finalUrl
+	if baseHref != "" {
+		baseUrl, err = w.crawlWorkParseUrls(finalUrl, baseHref)
+		if err != nil {
+			u.LinkErrors = append(u.LinkErrors, err)
+			baseUrl = finalUrl
+		}
+	}
+	var resolved []*Link
 	for _, link := range links {
-		foundUrl, err := w.crawlWorkParseUrls(crawlUrl, link)
+		foundUrl, err := w.crawlWorkParseUrls(baseUrl, link.Url)
 		if err != nil {
-			if u.Err == nil {
-				u.Err = err
-			} else {
-				u.Err = makeError("%s && %s", u.Err, err)
-			}
+			u.LinkErrors = append(u.LinkErrors, err)
 			continue
 		}
-		u.FoundUrls = append(u.FoundUrls, &foundUrl)
+		link.Raw = link.Url
+		link.Url = foundUrl
+		resolved = append(resolved, link)
+	}
+	resolved, err = w.crawler.Hooks.links(u, resolved)
+	if err != nil {
+		u.Err = err
+		return
+	}
+	for _, link := range resolved {
+		w.checkLink(link)
+		switch {
+		case link.HasRel("nofollow") == false || w.crawler.Nofollow == NofollowFollow:
+			u.addLink(link)
+		case w.crawler.Nofollow == NofollowReport:
+			u.NofollowLinks = append(u.NofollowLinks, link)
+		}
 	}
 
 	// success!!!
@@ -143,97 +414,338 @@ func (w *crawlWorker) crawlWork(crawlUrl string, depth int) (u *FoundUrls) {
 func (w *crawlWorker) crawlWorkParseUrls(crawlUrl string, link string) (foundUrl string, err error) {
 	if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
 		foundUrl = link
+	} else if w.siteRoot != nil && strings.HasPrefix(crawlUrl, "file:") && strings.HasPrefix(link, "/") && strings.HasPrefix(link, "//") == false {
+		// root-relative link in a local site, relative to the site root, not to the root of the filesystem
+		rel, errP := w.siteRoot.Parse("./" + strings.TrimPrefix(link, "/"))
+		if errP != nil {
+			err = &ParseLinkError{Base: crawlUrl, Link: link, Err: errP}
+			return
+		}
+		foundUrl = rel.String()
 	} else {
 		linkUrl, errP := url.Parse(crawlUrl)
 		if errP != nil {
-			err = makeError("url.Parse: %s", errP)
+			err = &ParseLinkError{Base: crawlUrl, Link: link, Err: errP}
 			return
 		}
 		rel, errP := linkUrl.Parse(link)
 		if errP != nil {
-			err = makeError("url.Parse.Parse(%s): %s", link, errP)
+			err = &ParseLinkError{Base: crawlUrl, Link: link, Err: errP}
 			return
 		}
 		foundUrl = rel.String()
 	}
+
+	// canonical form, used for dedup, scope and output
+	if w.crawler.Normalizer != nil {
+		normalized, errN := w.crawler.Normalizer.Normalize(foundUrl)
+		if errN != nil {
+			err = &ParseLinkError{Base: crawlUrl, Link: link, Err: errN}
+			return
+		}
+		foundUrl = normalized
+	}
 	return
 }
 
-func (w *crawlWorker) crawlWorkHashLoopCheck(crawlUrl string, resp *http.Response) (respBody io.Reader, err error) {
+// reads the whole body when fingerprinting is enabled, returns reader over what was read
+func (w *crawlWorker) crawlWorkHashLoopCheck(u *FoundUrls, resp *Response) (respBody io.Reader, err error) {
+	if w.crawler.HashLoopCheck == false && w.nearDuplicates == nil {
+		return resp.Body, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = &FetchError{Url: u.CrawlUrl, Op: "read body", Err: err}
+		return
+	}
+	respBody = bytes.NewReader(body)
 	if w.crawler.HashLoopCheck == true {
-		hasher := sha256.New()
-		respBody = io.TeeReader(resp.Body, hasher)
-		sum := hasher.Sum(nil)
+		sum := sha256.Sum256(body)
 		w.hashMutex.Lock()
-		defer w.hashMutex.Unlock()
-		for hashUrl, hash := range w.crawledUrlHash {
-			if bytes.Compare(*hash, sum) == 0 {
-				err = makeError("HashLoopCheck: %s", hashUrl)
+		hashUrl, ok := w.crawledUrlHash[sum]
+		if ok == false {
+			w.crawledUrlHash[sum] = u.CrawlUrl
+		}
+		w.hashMutex.Unlock()
+		// a page crawled again after resuming from a checkpoint is not a loop
+		if ok == true && hashUrl != u.CrawlUrl {
+			err = &HashLoopError{Url: u.CrawlUrl, DuplicateOf: hashUrl}
+			return
+		}
+	}
+	if w.nearDuplicates != nil {
+		u.SimHash = simHash(body)
+		u.NearDuplicateOf = w.nearDuplicates.add(u.CrawlUrl, u.SimHash)
+	}
+	return
+}
+
+// makes the request, retrying failures allowed by Crawler.RetryPolicy up to Crawler.Retries times
+// attempts is the number of requests made
+func (w *crawlWorker) crawlWorkGetRetry(method string, crawlUrl string) (resp *Response, attempts int, err error) {
+	for retries := 0; ; retries += 1 {
+		attempts += 1
+		resp, err = w.doFetch(method, crawlUrl)
+		if err == nil {
+			return
+		}
+		retry := retries < w.crawler.Retries && w.crawler.RetryPolicy.retryable(err) == true
+		if retry == true && w.ctx.Err() != nil {
+			// no retry is started after the cancel, the job is queued again instead
+			retry = false
+			err = &FetchError{Url: crawlUrl, Op: "retry", Err: w.ctx.Err()}
+		}
+		var delay time.Duration
+		if retry == true {
+			delay = w.crawler.RetryPolicy.delay(w.crawler.SleepBetweenRetries, retries, resp)
+		}
+		// error with a response means bad statusCode, nobody is going to read the body
+		if resp != nil {
+			_ = resp.Body.Close()
+			resp = nil
+		}
+		if retry == false {
+			err = fmt.Errorf("doHttpRequest: %w", err)
+			return
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-w.ctx.Done():
+				err = fmt.Errorf("doHttpRequest: %w", &FetchError{Url: crawlUrl, Op: "retry", Err: w.ctx.Err()})
 				return
 			}
 		}
-		w.crawledUrlHash[crawlUrl] = &sum
-	} else {
-		respBody = resp.Body
 	}
-	return
 }
 
-func (w *crawlWorker) crawlWorkGetRetry(crawlUrl string) (resp *http.Response, err error) {
-	for retries := 0; retries <= w.crawler.Retries; retries += 1 {
-		resp, err = w.doHttpRequest(crawlUrl)
-		if err != nil {
-			if retries == w.crawler.Retries {
-				err = makeError("doHttpRequest: %s", err)
+// fetches crawlUrl, handling 3xx responses according to Crawler.Redirects
+// resp == nil with err == nil means there is nothing to parse: redirect was recorded only, or its target is crawled on its own
+// finalUrl is the URL resp came from, to resolve relative links against
+// with checkOnly, redirects are followed to the end regardless of scope, as we only want to know if the target exists
+// each followed target goes through Crawler.Hooks enqueue hooks first, same as a found link, with the depth of crawlUrl
+func (w *crawlWorker) crawlWorkFollowRedirects(crawlUrl string, depth int, method string, checkOnly bool) (resp *Response, finalUrl string, redirects []*Redirect, attempts int, err error) {
+	finalUrl = crawlUrl
+	for {
+		var hopAttempts int
+		resp, hopAttempts, err = w.crawlWorkGetRetry(method, finalUrl)
+		attempts += hopAttempts
+		if err == nil && resp.Url != "" {
+			finalUrl = resp.Url
+		}
+		if err != nil || isRedirect(resp) == false {
+			return
+		}
+		_ = resp.Body.Close()
+		location, errP := w.crawlWorkParseUrls(finalUrl, resp.Header.Get("Location"))
+		if errP != nil {
+			resp = nil
+			err = fmt.Errorf("redirect Location: %w", errP)
+			return
+		}
+		redirects = append(redirects, &Redirect{StatusCode: resp.StatusCode, Url: finalUrl, Location: location})
+		resp = nil
+		redirectErr := &RedirectError{Url: finalUrl, Location: location, StatusCode: redirects[len(redirects)-1].StatusCode, Hops: len(redirects)}
+		switch {
+		case checkOnly == false && w.crawler.Redirects == RedirectRecord:
+			return
+		case checkOnly == false && w.crawler.Redirects == RedirectRefuse:
+			redirectErr.Reason = RedirectReasonRefused
+			err = redirectErr
+			return
+		case redirectLoop(redirects, location) == true:
+			redirectErr.Reason = RedirectReasonLoop
+			err = redirectErr
+			return
+		case len(redirects) > w.crawler.MaxRedirects:
+			redirectErr.Reason = RedirectReasonTooMany
+			err = redirectErr
+			return
+		case checkOnly == true:
+			location, ok := w.enqueueHooks(location, depth, finalUrl, true)
+			if ok == false {
 				return
-			} else if w.crawler.SleepBetweenRetries > 0 {
-				time.Sleep(w.crawler.SleepBetweenRetries)
 			}
-		} else {
-			break
+			finalUrl = location
+			continue
+		case w.inScope(location) == false && w.crawler.CheckExternal == true:
+			// not ours to crawl, but the target still gets checked, as a found link
+			return
+		case w.inScope(location) == false:
+			_, reason := w.scope.check(location)
+			err = fmt.Errorf("redirect: %w", &ScopeError{Url: location, Reason: reason})
+			return
+		case w.filtered(location) == true || w.traps.check(location) != "":
+			// excluded by Crawler.Rules or caught by Crawler.Traps, reported as a found link, never fetched
+			return
+		}
+		if allowed, _ := w.crawlWorkRobots(location); allowed == false {
+			err = fmt.Errorf("redirect: %w", &RobotsDisallowedError{Url: location})
+			return
+		}
+		location, ok := w.enqueueHooks(location, depth, finalUrl, false)
+		if ok == false {
+			return
 		}
+		// target already crawled or queued, no need to fetch it again
+		doWork, errC := w.crawlWorkCheckList(location, false)
+		if errC != nil {
+			err = errC
+			return
+		}
+		if doWork == false {
+			return
+		}
+		finalUrl = location
+	}
+}
+
+// checks if crawlUrl exists, with HEAD, falling back to GET if HEAD fails, body is not read
+func (w *crawlWorker) crawlWorkCheck(crawlUrl string, depth int, referrer string) (u *FoundUrls) {
+	u = new(FoundUrls)
+	u.CrawlUrl = crawlUrl
+	u.Depth = depth
+	u.Referrer = referrer
+	u.CheckOnly = true
+
+	allowed, _ := w.crawlWorkRobots(crawlUrl)
+	if allowed == false {
+		u.Skipped = SkippedRobots
+		return
 	}
+
+	resp, finalUrl, redirects, attempts, err := w.crawlWorkFollowRedirects(crawlUrl, depth, "HEAD", true)
+	u.Attempts = attempts
+	if err != nil && headFallback(err) == true {
+		resp, finalUrl, redirects, attempts, err = w.crawlWorkFollowRedirects(crawlUrl, depth, "GET", true)
+		u.Attempts += attempts
+	}
+	u.Redirects = redirects
+	if err != nil {
+		u.Err = err
+		u.setStatusFromError()
+		return
+	}
+	if resp == nil {
+		// redirect target dropped by an enqueue hook
+		return
+	}
+	w.crawlWorkResponse(u, finalUrl, resp)
+	u.Err = w.crawler.Hooks.response(u, resp)
+	_ = resp.Body.Close()
+	u.Timings = responseTimings(resp)
 	return
 }
 
-func (w *crawlWorker) crawlWorkCheckList(crawlUrl string) (doWork bool) {
-	w.mutex.Lock()
-	defer w.mutex.Unlock()
-	for _, nurl := range w.crawledUrls {
-		if *nurl == crawlUrl {
-			return false
+// plenty of servers do not implement HEAD properly: 405, 501 and other 5xx responses, and network failures, get a second chance with GET
+// any other status, e.g. 404 or 410, is taken as it is, and so is a redirect error
+func headFallback(err error) bool {
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusMethodNotAllowed || statusErr.StatusCode >= 500
+	}
+	var fetchErr *FetchError
+	return errors.As(err, &fetchErr) && errors.Is(err, context.Canceled) == false
+}
+
+// copies details of the final response to u
+func (w *crawlWorker) crawlWorkResponse(u *FoundUrls, finalUrl string, resp *Response) {
+	u.FinalUrl = finalUrl
+	u.StatusCode = resp.StatusCode
+	u.ContentType = resp.Header.Get("Content-Type")
+	u.ContentLength = resp.ContentLength
+	u.Headers = reportHeaders(resp.Header, w.crawler.ReportHeaders)
+	if lastModified, errT := http.ParseTime(resp.Header.Get("Last-Modified")); errT == nil {
+		u.LastModified = lastModified
+	}
+}
+
+// location is a URL already visited in this redirect chain
+func redirectLoop(redirects []*Redirect, location string) bool {
+	for _, redirect := range redirects {
+		if redirect.Url == location {
+			return true
 		}
 	}
-	w.crawledUrls = append(w.crawledUrls, &crawlUrl)
-	return true
+	return false
 }
 
-// handle actual HTTP call, return response or error, calling function can deal with the retries, if any
-func (w *crawlWorker) doHttpRequest(crawlUrl string) (r *http.Response, err error) {
-	// create http client, configure it and call to make a GET request
-	client := new(http.Client)
-	client.Timeout = w.crawler.Timeout
-	var req *http.Request
-	req, err = http.NewRequest("GET", crawlUrl, nil)
+// response is a redirect we can follow
+func isRedirect(resp *Response) bool {
+	return resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != ""
+}
+
+// prefix of the SeenStore key marking a URL queued for crawling, not only for checking
+const seenNavigationKey = "\x00"
+
+// claims crawlUrl for a job, doWork == false if it was claimed before
+// a URL queued to be checked only (checkOnly) can still be claimed for crawling later, a URL queued for crawling cannot be claimed again
+func (w *crawlWorker) crawlWorkCheckList(crawlUrl string, checkOnly bool) (doWork bool, err error) {
+	if checkOnly == true {
+		doWork, err = w.seen.Add(crawlUrl)
+	} else {
+		doWork, err = w.seen.Add(seenNavigationKey + crawlUrl)
+		if err == nil && doWork == true {
+			// no need to check it as well, once crawled
+			_, err = w.seen.Add(crawlUrl)
+		}
+	}
 	if err != nil {
-		err = makeError("http.NewRequest: %s", err)
+		doWork = false
+		err = &SeenStoreError{Url: crawlUrl, Err: err}
+	}
+	return
+}
+
+// fetch a single URL with Crawler.Fetcher, return response or error, calling function can deal with the retries, if any
+func (w *crawlWorker) doFetch(method string, crawlUrl string) (r *Response, err error) {
+	parsed, err := url.Parse(crawlUrl)
+	if err != nil {
+		err = &FetchError{Url: crawlUrl, Op: "url.Parse", Err: err}
 		return
 	}
-	if w.crawler.UserAgent != nil {
-		req.Header.Set("User-Agent", *w.crawler.UserAgent)
+
+	// per-host politeness, connection slot is held until the body is closed
+	// a request still waiting for its slot when the crawl is cancelled is not sent
+	release, err := w.hostLimiter.acquire(w.ctx, parsed.Host)
+	if err != nil {
+		err = &FetchError{Url: crawlUrl, Op: "hostLimiter", Err: err}
+		return
 	}
-	if w.crawler.Auth != nil {
-		req.SetBasicAuth(w.crawler.Auth.Username, w.crawler.Auth.Password)
+	header := w.crawler.requestHeader()
+	err = w.crawler.Hooks.request(method, crawlUrl, header)
+	if err != nil {
+		release()
+		err = &FetchError{Url: crawlUrl, Op: "OnRequest", Err: err}
+		return
+	}
+	ctx := withRequestTimer(w.requestCtx)
+	r, err = w.fetcher.Fetch(ctx, method, crawlUrl, header)
+	if err == nil && r == nil {
+		err = ErrNoResponse
 	}
-	r, err = client.Do(req)
 	if err != nil {
-		err = makeError("http.Do: %s", err)
+		release()
+		r = nil
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) == false {
+			err = &FetchError{Url: crawlUrl, Op: "Fetch", Err: err}
+		}
 		return
 	}
+	r.timer = requestTimerFrom(ctx)
+	r.timer.responded()
+	if r.Header == nil {
+		r.Header = make(http.Header)
+	}
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	r.Body = &releaseOnClose{ReadCloser: r.Body, release: release}
 
-	// handle statusCode other than success
-	if r.StatusCode < 200 || r.StatusCode >= 300 {
-		err = makeError("statusCode: %d", r.StatusCode)
+	// handle statusCode other than success, redirects are returned to the caller
+	if (r.StatusCode < 200 || r.StatusCode >= 300) && isRedirect(r) == false {
+		err = &HTTPStatusError{Url: crawlUrl, StatusCode: r.StatusCode}
 		return
 	}
 
@@ -0,0 +1,293 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// redirect from crawlUrl to location
+func redirectPage(status int, location string) *MemoryPage {
+	return &MemoryPage{StatusCode: status, Header: http.Header{"Location": {location}}}
+}
+
+func redirectTestPages() map[string]*MemoryPage {
+	return map[string]*MemoryPage{
+		"http://a/":      redirectPage(301, "/a/"),
+		"http://a/a/":    redirectPage(302, "/b/"),
+		"http://a/b/":    {Body: `<a href="/c">c</a>`},
+		"http://a/ext":   redirectPage(302, "http://other/"),
+		"http://a/loop1": redirectPage(302, "/loop2"),
+		"http://a/loop2": redirectPage(302, "/loop1"),
+		"http://a/self":  redirectPage(302, "/self"),
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	newWorker := func(policy RedirectPolicy, maxRedirects int) *crawlWorker {
+		c := NewCrawler()
+		c.IgnoreRobots = true
+		c.Redirects = policy
+		c.MaxRedirects = maxRedirects
+		c.Fetcher = NewMemoryFetcher(redirectTestPages())
+		return newCrawlWorker(context.Background(), c, "http://a/", func(*FoundUrls) {})
+	}
+
+	// follow: each hop is reported, the page is parsed at the end of the chain
+	u := newWorker(RedirectFollow, 10).crawlWork("http://a/", 0, "")
+	if u.Err != nil || len(u.Redirects) != 2 || u.Redirects[0].StatusCode != 301 || u.Redirects[1].Location != "http://a/b/" || u.FinalUrl != "http://a/b/" || u.StatusCode != 200 || len(u.Links) != 1 {
+		t.Errorf("follow: %v %v %s %d", u.Err, u.Redirects, u.FinalUrl, u.StatusCode)
+	}
+
+	// record: first hop only, target reported as a found link
+	u = newWorker(RedirectRecord, 10).crawlWork("http://a/", 0, "")
+	if u.Err != nil || len(u.Redirects) != 1 || len(u.FoundUrls) != 1 || *u.FoundUrls[0] != "http://a/a/" {
+		t.Errorf("record: %v %v %v", u.Err, u.Redirects, u.FoundUrls)
+	}
+
+	// refuse: first hop reported as an error
+	u = newWorker(RedirectRefuse, 10).crawlWork("http://a/", 0, "")
+	var redirectErr *RedirectError
+	if errors.As(u.Err, &redirectErr) == false || redirectErr.Reason != RedirectReasonRefused || redirectErr.StatusCode != 301 || len(u.Redirects) != 1 {
+		t.Errorf("refuse: %v %v", u.Err, u.Redirects)
+	}
+
+	// more hops than MaxRedirects
+	u = newWorker(RedirectFollow, 1).crawlWork("http://a/", 0, "")
+	if errors.As(u.Err, &redirectErr) == false || redirectErr.Reason != RedirectReasonTooMany || redirectErr.Hops != 2 {
+		t.Errorf("max redirects: %v %v", u.Err, u.Redirects)
+	}
+
+	// target out of scope
+	u = newWorker(RedirectFollow, 10).crawlWork("http://a/ext", 0, "")
+	var scopeErr *ScopeError
+	if errors.As(u.Err, &scopeErr) == false || scopeErr.Url != "http://other/" {
+		t.Errorf("out of scope: %v", u.Err)
+	}
+
+	// loops, crawled and checked
+	for _, loop := range []string{"http://a/loop1", "http://a/self"} {
+		u = newWorker(RedirectFollow, 10).crawlWork(loop, 0, "")
+		if errors.As(u.Err, &redirectErr) == false || redirectErr.Reason != RedirectReasonLoop || redirectErr.Location != loop {
+			t.Errorf("loop %s: %v %v", loop, u.Err, u.Redirects)
+		}
+		u = newWorker(RedirectFollow, 10).crawlWorkCheck(loop, 0, "")
+		if errors.As(u.Err, &redirectErr) == false || redirectErr.Reason != RedirectReasonLoop {
+			t.Errorf("check loop %s: %v %v", loop, u.Err, u.Redirects)
+		}
+	}
+}
+
+func TestRedirectEnqueueHook(t *testing.T) {
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(redirectTestPages())
+	c.Hooks.OnEnqueue(func(crawlUrl string, depth int, referrer string) (string, bool) {
+		return crawlUrl, crawlUrl != "http://a/b/"
+	})
+	var fetched []string
+	c.Hooks.OnRequest(func(method string, crawlUrl string, header http.Header) {
+		fetched = append(fetched, crawlUrl)
+	})
+	c.Workers = 1
+	c.Crawl("http://a/", func(u *FoundUrls) {})
+	for _, crawlUrl := range fetched {
+		if crawlUrl == "http://a/b/" {
+			t.Errorf("redirect target dropped by OnEnqueue was fetched: %s", fetched)
+		}
+	}
+}
+
+func TestCheckedThenCrawled(t *testing.T) {
+	// /de/ is first found as an asset, then as navigation, it must still be crawled
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{
+		"http://a/":             {Body: `<html><link rel="next" href="/page/2"><link rel="preload" href="/de/"><a href="/page/2">2</a><a href="/de/">de</a>`},
+		"http://a/page/2":       {Body: `<a href="/page/3">3</a>`},
+		"http://a/page/3":       {Body: `<html>3</html>`},
+		"http://a/de/":          {Body: `<a href="/de/impressum">impressum</a>`},
+		"http://a/de/impressum": {Body: `<html>impressum</html>`},
+	})
+	c.SerializeCallbacks = true
+	crawled := make(map[string]int)
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		if u.CheckOnly == false {
+			crawled[u.CrawlUrl] += 1
+		}
+	})
+	for _, crawlUrl := range []string{"http://a/page/2", "http://a/page/3", "http://a/de/", "http://a/de/impressum"} {
+		if crawled[crawlUrl] != 1 {
+			t.Errorf("%s crawled %d times", crawlUrl, crawled[crawlUrl])
+		}
+	}
+}
+
+// serves HEAD requests from head, GET requests from get, recording each request as "METHOD url"
+type methodFetcher struct {
+	head     Fetcher
+	get      Fetcher
+	mutex    sync.Mutex
+	requests []string
+}
+
+func (f *methodFetcher) Fetch(ctx context.Context, method string, crawlUrl string, header http.Header) (*Response, error) {
+	f.mutex.Lock()
+	f.requests = append(f.requests, method+" "+crawlUrl)
+	f.mutex.Unlock()
+	if method == "HEAD" {
+		return f.head.Fetch(ctx, method, crawlUrl, header)
+	}
+	return f.get.Fetch(ctx, method, crawlUrl, header)
+}
+
+func TestCheckHeadFallback(t *testing.T) {
+	get := map[string]*MemoryPage{
+		"http://a/no-head": {Body: "<html></html>"},
+		"http://a/flaky":   {Body: "<html></html>"},
+	}
+	head := map[string]*MemoryPage{
+		"http://a/no-head": {StatusCode: 405},
+		"http://a/flaky":   {StatusCode: 503},
+		"http://a/gone":    {StatusCode: 410},
+	}
+	checks := map[string][]string{
+		"http://a/no-head": {"HEAD http://a/no-head", "GET http://a/no-head"},
+		"http://a/flaky":   {"HEAD http://a/flaky", "GET http://a/flaky"},
+		"http://a/gone":    {"HEAD http://a/gone"},
+		"http://a/missing": {"HEAD http://a/missing"},
+	}
+	for crawlUrl, expected := range checks {
+		c := NewCrawler()
+		c.IgnoreRobots = true
+		f := &methodFetcher{head: NewMemoryFetcher(head), get: NewMemoryFetcher(get)}
+		c.Fetcher = f
+		u := newCrawlWorker(context.Background(), c, "http://a/", func(*FoundUrls) {}).crawlWorkCheck(crawlUrl, 1, "http://a/")
+		if strings.Join(f.requests, ", ") != strings.Join(expected, ", ") {
+			t.Errorf("%s: requests %v", crawlUrl, f.requests)
+		}
+		if (get[crawlUrl] != nil) != (u.Err == nil) {
+			t.Errorf("%s: %v", crawlUrl, u.Err)
+		}
+	}
+}
+
+func TestMaxDepthChecksAssets(t *testing.T) {
+	// pages at MaxDepth are not followed further, their assets are still checked
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.MaxDepth = 1
+	c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{
+		"http://a/":  {Body: `<a href="/b">b</a><img src="/a.png">`},
+		"http://a/b": {Body: `<a href="/c">c</a><img src="/broken.png">`},
+		"http://a/c": {Body: `<html>c</html>`},
+	})
+	c.SerializeCallbacks = true
+	reported := make(map[string]*FoundUrls)
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		reported[u.CrawlUrl] = u
+	})
+	if u := reported["http://a/broken.png"]; u == nil || u.CheckOnly == false || u.StatusCode != 404 || u.Depth != 2 {
+		t.Errorf("asset of the deepest page: %v", u)
+	}
+	if reported["http://a/c"] != nil || len(reported) != 4 {
+		t.Errorf("crawled past MaxDepth: %v", reported)
+	}
+}
+
+func TestTrapsExternalLinks(t *testing.T) {
+	// external links are only counted against Crawler.Traps when they get checked
+	body := ""
+	for i := 0; i < 4; i++ {
+		body += fmt.Sprintf(`<a href="http://ext/cal?month=%d">%d</a>`, i, i)
+	}
+	for _, checkExternal := range []bool{false, true} {
+		c := NewCrawler()
+		c.IgnoreRobots = true
+		c.CheckExternal = checkExternal
+		c.Traps.MaxQueryVariants = 2
+		c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{"http://a/": {Body: body}})
+		c.SerializeCallbacks = true
+		traps := 0
+		c.Crawl("http://a/", func(u *FoundUrls) {
+			for _, link := range u.Links {
+				if link.Trap != "" {
+					traps += 1
+				}
+			}
+		})
+		if (checkExternal == false && traps != 0) || (checkExternal == true && traps != 2) {
+			t.Errorf("CheckExternal %t: %d traps", checkExternal, traps)
+		}
+	}
+}
+
+func TestBaseHref(t *testing.T) {
+	// relative links are resolved against <base href>, and crawled from there
+	c := NewCrawler()
+	c.IgnoreRobots = true
+	c.Fetcher = NewMemoryFetcher(map[string]*MemoryPage{
+		"http://a/":      {Body: `<html><head><base href="/sub/"></head><a href="x">x</a><img src="http://cdn/a.png"></html>`},
+		"http://a/sub/x": {Body: `<html><head><base href="http://cdn/assets/"></head><img src="y.png"></html>`},
+	})
+	c.SerializeCallbacks = true
+	reported := make(map[string]*FoundUrls)
+	c.Crawl("http://a/", func(u *FoundUrls) {
+		reported[u.CrawlUrl] = u
+	})
+	if u := reported["http://a/sub/x"]; u == nil || u.StatusCode != 200 || reported["http://a/x"] != nil {
+		t.Errorf("link not resolved against <base href>: %v", reported)
+		t.FailNow()
+	}
+	links := reported["http://a/sub/x"].Links
+	if len(links) != 1 || links[0].Url != "http://cdn/assets/y.png" || links[0].Raw != "y.png" || links[0].InScope == true {
+		t.Errorf("links: %v", links)
+	}
+}
+
+func TestNofollow(t *testing.T) {
+	pages := map[string]*MemoryPage{
+		"http://a/":         {Body: `<a href="/follow">f</a><a href="/nofollow" rel="nofollow">n</a><a href="/ugc" rel="ugc NoFollow">u</a>`},
+		"http://a/follow":   {Body: `<html></html>`},
+		"http://a/nofollow": {Body: `<html></html>`},
+		"http://a/ugc":      {Body: `<html></html>`},
+	}
+	for _, policy := range []NofollowPolicy{NofollowFollow, NofollowSkip, NofollowReport} {
+		c := NewCrawler()
+		c.IgnoreRobots = true
+		c.Nofollow = policy
+		c.Fetcher = NewMemoryFetcher(pages)
+		c.SerializeCallbacks = true
+		reported := make(map[string]*FoundUrls)
+		c.Crawl("http://a/", func(u *FoundUrls) {
+			reported[u.CrawlUrl] = u
+		})
+		seed := reported["http://a/"]
+		if seed == nil || reported["http://a/follow"] == nil {
+			t.Errorf("policy %d: %v", policy, reported)
+			continue
+		}
+		var nofollow []string
+		for _, link := range seed.NofollowLinks {
+			nofollow = append(nofollow, link.Url)
+		}
+		switch policy {
+		case NofollowFollow:
+			if len(reported) != 4 || len(seed.Links) != 3 || len(nofollow) != 0 {
+				t.Errorf("NofollowFollow: %d reported, %d links, nofollow %v", len(reported), len(seed.Links), nofollow)
+			}
+		case NofollowSkip:
+			if len(reported) != 2 || len(seed.Links) != 1 || len(nofollow) != 0 {
+				t.Errorf("NofollowSkip: %d reported, %d links, nofollow %v", len(reported), len(seed.Links), nofollow)
+			}
+		case NofollowReport:
+			if len(reported) != 2 || len(seed.Links) != 1 || strings.Join(nofollow, " ") != "http://a/nofollow http://a/ugc" {
+				t.Errorf("NofollowReport: %d reported, %d links, nofollow %v", len(reported), len(seed.Links), nofollow)
+			}
+		}
+	}
+}
@@ -4,75 +4,260 @@ package main
 
 import (
 	"./crawler"
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // will be copying output in callback to this before parsing to json - json.Marshall doesn't handle error type
 type JsonOutput struct {
-	CrawledUrl string
-	FoundUrls  []*string
-	Depth      int
-	Error      string
+	CrawledUrl      string
+	FoundUrls       []*string
+	Links           []*crawler.Link `json:",omitempty"`
+	NofollowLinks   []*crawler.Link `json:",omitempty"`
+	Depth           int
+	Error           string
+	Redirects       []*crawler.Redirect `json:",omitempty"`
+	Skipped         string              `json:",omitempty"`
+	Sitemaps        []*string           `json:",omitempty"`
+	FinalUrl        string              `json:",omitempty"`
+	StatusCode      int                 `json:",omitempty"`
+	ContentType     string              `json:",omitempty"`
+	LastModified    string              `json:",omitempty"`
+	NearDuplicateOf string              `json:",omitempty"`
+	Referrer        string              `json:",omitempty"`
+	ContentLength   int64               `json:",omitempty"`
+	BytesRead       int64               `json:",omitempty"`
+	Headers         map[string][]string `json:",omitempty"`
+	Timings         *JsonTimings        `json:",omitempty"`
+	LinkErrors      []string            `json:",omitempty"`
+	Attempts        int                 `json:",omitempty"`
+	CheckOnly       bool                `json:",omitempty"`
+}
+
+// crawler.Timings in milliseconds
+type JsonTimings struct {
+	DNS     float64
+	Connect float64
+	TLS     float64
+	TTFB    float64
+	Total   float64
 }
 
 // struct for callback method, to pass arguments to callback
 type Callback struct {
-	indent bool
 	errStderr bool
+	writer    resultWriter
+}
+
+// repeatable -host-limit flag, host=rate[,burst[,connections]], missing values taken from -host-* defaults
+type hostLimitFlags []string
+
+func (h *hostLimitFlags) String() string {
+	return strings.Join(*h, " ")
+}
+
+func (h *hostLimitFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+// repeatable -include, -exclude and -rules flags, all adding to the same list so command line order is kept
+type urlRuleFlag struct {
+	action string
+	rules  *[]*crawler.UrlRule
+}
+
+func (r *urlRuleFlag) String() string {
+	return ""
+}
+
+func (r *urlRuleFlag) Set(value string) error {
+	if r.action == "rules" {
+		f, err := os.Open(value)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		rules, err := crawler.ParseRules(f)
+		if err != nil {
+			return fmt.Errorf("%s: %s", value, err)
+		}
+		*r.rules = append(*r.rules, rules...)
+		return nil
+	}
+	rule, err := crawler.NewRule(r.action == "include", value)
+	if err != nil {
+		return err
+	}
+	*r.rules = append(*r.rules, rule)
+	return nil
+}
+
+// parses -host-limit values into per-host overrides
+func (h *hostLimitFlags) parse(defaults crawler.HostLimit) (limits map[string]crawler.HostLimit, err error) {
+	limits = make(map[string]crawler.HostLimit)
+	for _, value := range *h {
+		kv := strings.SplitN(value, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("-host-limit %s: expected host=rate[,burst[,connections]]", value)
+		}
+		limit := defaults
+		parts := strings.Split(kv[1], ",")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("-host-limit %s: expected host=rate[,burst[,connections]]", value)
+		}
+		if parts[0] != "" {
+			limit.RequestsPerSecond, err = strconv.ParseFloat(parts[0], 64)
+		}
+		if err == nil && len(parts) > 1 && parts[1] != "" {
+			limit.Burst, err = strconv.Atoi(parts[1])
+		}
+		if err == nil && len(parts) > 2 && parts[2] != "" {
+			limit.MaxConnections, err = strconv.Atoi(parts[2])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("-host-limit %s: %s", value, err)
+		}
+		limits[kv[0]] = limit
+	}
+	return
+}
+
+// parses -extract value, tag:attribute:kind,...
+func parseLinkSources(value string) (sources []crawler.LinkSource, err error) {
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("-extract %s: expected tag:attribute:kind", item)
+		}
+		kind := crawler.LinkKind(parts[2])
+		if kind != crawler.LinkNavigation && kind != crawler.LinkAsset {
+			return nil, fmt.Errorf("-extract %s: kind must be %s or %s", item, crawler.LinkNavigation, crawler.LinkAsset)
+		}
+		sources = append(sources, crawler.LinkSource{Tag: parts[0], Attr: parts[1], Kind: kind})
+	}
+	return
+}
+
+// splits comma separated flag value, dropping empty items
+func splitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// joins ints with commas, for flag defaults
+func joinInts(values []int) string {
+	var items []string
+	for _, value := range values {
+		items = append(items, strconv.Itoa(value))
+	}
+	return strings.Join(items, ",")
 }
 
 // callback method, called from crawler
-// received crawler.FoundUrls, parses, prints json
+// received crawler.FoundUrls, prints errors if asked to, passes to output writer
 func (c *Callback) callback(u *crawler.FoundUrls) {
-	nu := new(JsonOutput)
-	nu.CrawledUrl = u.CrawlUrl
-	nu.FoundUrls = u.FoundUrls
-	nu.Depth = u.Depth
-	if u.Err != nil {
-		nu.Error = u.Err.Error()
-		if c.errStderr == true {
-			_, _ = fmt.Fprintf(os.Stderr,"ERROR in `%s`: %s\n", u.CrawlUrl, u.Err)
-		}
-	}
-	var b []byte
-	var err error
-	if c.indent == true {
-		b, err = json.MarshalIndent(nu, "", "\t")
-	} else {
-		b, err = json.Marshal(nu)
+	if u.Err != nil && c.errStderr == true {
+		_, _ = fmt.Fprintf(os.Stderr, "ERROR in `%s`: %s\n", u.CrawlUrl, u.Err)
 	}
+	if c.errStderr == true {
+		for _, err := range u.LinkErrors {
+			_, _ = fmt.Fprintf(os.Stderr, "ERROR in `%s`: %s\n", u.CrawlUrl, err)
+		}
+	}
+	err := c.writer.write(u)
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Could not make json from output: %s\n", err)
-		return
+		_, _ = fmt.Fprintf(os.Stderr, "Could not write output: %s\n", err)
 	}
-	fmt.Printf("%s,\n", string(b))
 }
 
 // entrypoint
-// parses command line arguments, sets handler for SIGINT, print json '[]' and runs crawler
+// parses command line arguments, sets handler for SIGINT, starts output and runs crawler
 func main() {
 	// parse command line arguments
 	errStdrr := flag.Bool("errors-to-stderr", false, "print errors to stderr in addition to reporting them in json")
-	indent := flag.Bool("indent", false, "indent output, or print each URL per line")
-	retries := flag.Int("retries", 0, "on http GET failure, retry this many times")
-	retrySleep := flag.Int("retry-sleep", 100, "sleep this many milliseconds between retries")
-	timeout := flag.Int("timeout", 60, "http GET timeout in seconds")
-	maxDepth := flag.Int("max-depth", -1, "max depth to crawl to, or -1 for unlimited")
-	followExternal := flag.Bool("follow-external", false, "follow URLs external to crawl URL, without max-depth may run indefinitely")
+	indent := flag.Bool("indent", false, "with -format json, indent output, or print each URL per line")
+	check := flag.Bool("check", false, "broken link checker mode: also check links out of crawl scope (HEAD, falling back to GET) without crawling them, report only broken links with their referrers, exit with code 3 if any are found")
+	extract := flag.String("extract", "", "comma separated list of tag:attribute:kind to extract links from, kind is navigation (crawled) or asset (only checked), e.g. a:href:navigation,img:src:asset (default: a, area, iframe, frame, form, meta refresh, link, script, img, source, video, audio, embed, object; <link> is navigation or asset depending on its rel)")
+	nofollow := flag.String("nofollow", "follow", "how to handle rel=nofollow links: follow (like any other link), skip (do not report or crawl) or report (report in NofollowLinks, do not crawl)")
+	format := flag.String("format", "json", "output format: json (single array), ndjson (one object per line) or sitemap-xml")
+	output := flag.String("output", "", "write output to this file instead of stdout, with -format sitemap-xml (default \"sitemap.xml\")")
+	sitemapGzip := flag.Bool("sitemap-gzip", false, "with -format sitemap-xml, gzip the sitemap files")
+	sitemapBaseUrl := flag.String("sitemap-base-url", "", "with -format sitemap-xml, URL the sitemap files will be published under, used in sitemap index (default: crawl URL's scheme://host/)")
+	var sitemapRules sitemapRuleFlags
+	flag.Var(&sitemapRules, "sitemap-rule", "with -format sitemap-xml, set changefreq and priority of URLs matching regex, as regex=changefreq[,priority], may be repeated, first match wins")
+	retries := flag.Int("retries", 0, "on http GET failure, retry this many times, only for -retry-statuses, timeouts and temporary network errors")
+	retrySleep := flag.Int("retry-sleep", 100, "sleep this many milliseconds before the first retry, doubled with each retry, with full jitter")
+	retryMaxSleep := flag.Int("retry-max-sleep", int(crawler.DefaultRetryPolicy.MaxDelay/time.Millisecond), "max milliseconds to sleep between retries, also caps Retry-After, or 0 for no cap")
+	retryStatuses := flag.String("retry-statuses", joinInts(crawler.DefaultRetryPolicy.Statuses), "comma separated list of HTTP status codes to retry")
+	ignoreRetryAfter := flag.Bool("ignore-retry-after", false, "do not obey Retry-After headers, always use the backoff between retries")
+	timeout := flag.Int("timeout", 60, "total http GET timeout in seconds, from connecting until the body is read")
+	dialTimeout := flag.Int("dial-timeout", int(crawler.DefaultTransport.DialTimeout/time.Second), "TCP connect timeout in seconds, 0 for no limit")
+	tlsTimeout := flag.Int("tls-timeout", int(crawler.DefaultTransport.TLSHandshakeTimeout/time.Second), "TLS handshake timeout in seconds, 0 for no limit")
+	headerTimeout := flag.Int("header-timeout", int(crawler.DefaultTransport.ResponseHeaderTimeout/time.Second), "timeout in seconds waiting for response headers after sending the request, 0 for no limit")
+	noKeepAlive := flag.Bool("no-keepalive", false, "do not reuse connections, open a new one for each request")
+	idleConns := flag.Int("idle-conns-per-host", 0, "max idle connections kept open per host, 0 means the number of -workers")
+	maxDepth := flag.Int("max-depth", -1, "max depth to crawl to, or -1 for unlimited; assets and, with -check, external links of the deepest pages are still checked")
+	followExternal := flag.Bool("follow-external", false, "follow URLs external to crawl URL, same as -scope all, without max-depth may run indefinitely")
+	scope := flag.String("scope", "prefix", "which links to crawl: prefix (same host, path at or below crawl URL's path, or its directory if it is a file such as index.html), host (same host), subdomains (crawl URL's host and its subdomains), domain (same registrable domain, e.g. example.co.uk) or all")
+	siteRoot := flag.String("site-root", "", "when crawling a local directory or file:// URL, directory root-relative links (/foo) resolve against (default: the crawled directory)")
+	pathPrefix := flag.String("path-prefix", "", "only crawl URLs with a path at or below this prefix, e.g. /docs matches /docs/a but not /docsx (default: crawl URL's path, or its directory for a file, with -scope prefix)")
+	anyScheme := flag.Bool("any-scheme", false, "treat http and https URLs as the same site when checking scope")
+	ignoreWww := flag.Bool("ignore-www", false, "treat www.host and host as the same host when checking scope")
+	allowHosts := flag.String("allow-hosts", "", "comma separated list of hosts always in scope, *.example.com matches subdomains of example.com")
+	denyHosts := flag.String("deny-hosts", "", "comma separated list of hosts never in scope, *.example.com matches subdomains of example.com")
 	workers := flag.Int("workers", 10, "number of concurrent workers to crawl with")
 	hashCheck := flag.Bool("hash-check", false, "check for loops by using checksums on each html file, may be slow")
+	nearDuplicates := flag.Bool("near-duplicates", false, "report html pages with text similar to an earlier page in NearDuplicateOf, pages with the same NearDuplicateOf form a cluster, may be slow")
+	nearDuplicateDistance := flag.Int("near-duplicate-distance", 3, "with -near-duplicates, max number of differing SimHash bits (of 64) for pages to be near-duplicates")
+	reportHeaders := flag.String("report-headers", strings.Join(crawler.DefaultReportHeaders, ","), "comma separated list of response headers to report in Headers, or empty for none")
 	username := flag.String("username", "", "username for HTTP basic auth")
 	password := flag.String("password", "", "password for HTTP basic auth")
 	useragent := flag.String("user-agent", "", "set a custom user-agent for the crawler")
+	redirects := flag.String("redirects", "follow", "how to handle redirects: follow (in scope targets only), record (report target as found URL) or refuse (report as error)")
+	maxRedirects := flag.Int("max-redirects", 10, "with -redirects follow, max number of redirect hops to follow")
+	ignoreRobots := flag.Bool("ignore-robots", false, "do not fetch or obey robots.txt")
+	hostRate := flag.Float64("host-rate", 0, "max requests per second to each host, or 0 for unlimited")
+	hostBurst := flag.Int("host-burst", 1, "with -host-rate, number of requests allowed at once to each host after being idle")
+	hostConnections := flag.Int("host-connections", 0, "max concurrent requests to each host, or 0 for unlimited")
+	maxPathDepth := flag.Int("max-path-depth", crawler.DefaultTrapLimits.MaxPathDepth, "trap detection: do not fetch URLs with more path segments than this, or 0 for unlimited")
+	maxRepeatedSegments := flag.Int("max-repeated-segments", crawler.DefaultTrapLimits.MaxRepeatedSegments, "trap detection: do not fetch URLs with a path segment or group of segments repeated back to back more times than this, e.g. /a/b/a/b/a/b/a/b, or 0 for unlimited")
+	maxQueryVariants := flag.Int("max-query-variants", crawler.DefaultTrapLimits.MaxQueryVariants, "trap detection: do not fetch more distinct query strings than this for each path, or 0 for unlimited")
+	maxUrlLength := flag.Int("max-url-length", crawler.DefaultTrapLimits.MaxUrlLength, "trap detection: do not fetch URLs longer than this, or 0 for unlimited")
+	var urlRules []*crawler.UrlRule
+	flag.Var(&urlRuleFlag{"include", &urlRules}, "include", "crawl only URLs matching this regex (or glob:pattern, '*' matches any characters), may be repeated, first matching -include or -exclude wins")
+	flag.Var(&urlRuleFlag{"exclude", &urlRules}, "exclude", "do not fetch URLs matching this regex (or glob:pattern, '*' matches any characters), may be repeated, first matching -include or -exclude wins")
+	flag.Var(&urlRuleFlag{"rules", &urlRules}, "rules", "read -include and -exclude rules from this file, one per line as \"include pattern\" or \"exclude pattern\", '#' starts a comment")
+	var hostLimits hostLimitFlags
+	flag.Var(&hostLimits, "host-limit", "per-host override of -host-rate, -host-burst and -host-connections, as host=rate[,burst[,connections]], may be repeated")
+	seenStore := flag.String("seen-store", "memory", "where to keep track of crawled URLs: memory, bloom or disk")
+	bloomSize := flag.Int("bloom-size", 64, "with -seen-store bloom, max memory for the bloom filter in MB")
+	bloomExpected := flag.Int("bloom-expected", 1000000, "with -seen-store bloom, expected number of URLs, used to size the filter hashes")
+	seenDir := flag.String("seen-dir", "", "with -seen-store disk, directory to keep the seen URL table in (default: system temp dir)")
+	noNormalize := flag.Bool("no-normalize", false, "do not canonicalize URLs, use them as found in the pages")
+	keepFragment := flag.Bool("keep-fragment", false, "do not remove #fragment from URLs")
+	stripParams := flag.String("strip-params", strings.Join(crawler.DefaultTrackingParams, ","), "comma separated list of query parameter names to remove from URLs, '*' matches any characters, or empty to keep all")
+	trailingSlash := flag.String("trailing-slash", "keep", "trailing slash handling of URL paths: keep, add (unless path ends with a file name) or remove")
+	frontierMemory := flag.Int("frontier-memory", 100000, "max number of queued URLs to keep in memory, rest is spilled to a temp file, or -1 for unlimited")
+	checkpoint := flag.String("checkpoint", "", "periodically save crawl state to this file, on interrupt too, so the crawl can be continued with -resume; not with -format sitemap-xml (default: the -resume file)")
+	checkpointInterval := flag.Int("checkpoint-interval", 60, "with -checkpoint, save crawl state every this many seconds, or 0 to only save on interrupt and at the end")
+	resume := flag.String("resume", "", "continue the crawl saved in this checkpoint file, instead of starting from a URL, URLs reported before are not reported again; use the same options as the interrupted crawl, -output carries on from where the checkpoint was saved")
 	flag.Usage = func() {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s [options] {url}\n\n", os.Args[0])
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s [options] {url|dir}\n       %s [options] -resume checkpoint\n\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
-		_, _ = fmt.Fprintf(os.Stderr, "\nNotes:\n\t* the crawler does not follow redirects\n\t* instead of passing username, you can set env variable CRAWLER_USER\n\t* instead of passing password, you can set env variable CRAWLER_PASS\n\n")
+		_, _ = fmt.Fprintf(os.Stderr, "\nNotes:\n\t* redirects to URLs out of crawl scope are not followed\n\t* URLs disallowed by robots.txt are reported with Skipped set, but not fetched\n\t* URLs which are not text/html are reported with Skipped set to not-html, their body is not read\n\t* relative links are resolved against <base href> when the page has one\n\t* links excluded by -include/-exclude/-rules are reported with Filtered set, but not fetched\n\t* links caught by trap detection (-max-path-depth, -max-repeated-segments, -max-query-variants, -max-url-length) are reported with Trap set to the rule, but not fetched\n\t* URLs are canonicalized (lower-case host, no default port, dot segments resolved, sorted query) unless -no-normalize is set\n\t* a local directory or file:// URL is crawled from disk, /foo/ is served from foo/index.html, Content-Type is taken from the file extension\n\t* on SIGINT, requests in flight finish and are reported, no new ones are sent; with -checkpoint, URLs not crawled yet are crawled on -resume\n\t* -resume carries on -output from where the checkpoint was saved: -format json stays a single array, the -check report covers the whole crawl; -format sitemap-xml cannot be resumed\n\t* after a hard kill, as opposed to SIGINT, -resume starts from the last periodic checkpoint: -output is cut back to it, on stdout URLs reported since then are reported again\n\t* instead of passing username, you can set env variable CRAWLER_USER\n\t* instead of passing password, you can set env variable CRAWLER_PASS\n\n")
 	}
 	flag.Parse()
 
@@ -87,20 +272,164 @@ func main() {
 	// parase arguments to crawler struct
 	c := crawler.NewCrawler()
 	c.HashLoopCheck = *hashCheck
+	c.NearDuplicates = *nearDuplicates
+	c.NearDuplicateDistance = *nearDuplicateDistance
+	c.ReportHeaders = splitList(*reportHeaders)
 	c.Workers = *workers
 	c.MaxDepth = *maxDepth
 	c.FollowExternal = *followExternal
 	c.Retries = *retries
 	c.SleepBetweenRetries = time.Duration(*retrySleep) * time.Millisecond
+	c.RetryPolicy.MaxDelay = time.Duration(*retryMaxSleep) * time.Millisecond
+	c.RetryPolicy.RetryAfter = !*ignoreRetryAfter
+	c.RetryPolicy.Statuses = nil
+	for _, status := range splitList(*retryStatuses) {
+		code, errS := strconv.Atoi(status)
+		if errS != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "invalid -retry-statuses: %s\n", status)
+			flag.Usage()
+			os.Exit(2)
+		}
+		c.RetryPolicy.Statuses = append(c.RetryPolicy.Statuses, code)
+	}
+	c.FrontierMemoryLimit = *frontierMemory
 	if useragent != nil && *useragent != "" {
 		c.UserAgent = useragent
 	}
 	c.Timeout = time.Duration(*timeout) * time.Second
+	c.Transport.DialTimeout = time.Duration(*dialTimeout) * time.Second
+	c.Transport.TLSHandshakeTimeout = time.Duration(*tlsTimeout) * time.Second
+	c.Transport.ResponseHeaderTimeout = time.Duration(*headerTimeout) * time.Second
+	c.Transport.DisableKeepAlives = *noKeepAlive
+	c.Transport.MaxIdleConnsPerHost = *idleConns
 	if user != "" || pass != "" {
 		cAuth := crawler.CrawlerAuth{Username: user, Password: pass}
 		c.Auth = &cAuth
 	}
+	c.MaxRedirects = *maxRedirects
+	c.IgnoreRobots = *ignoreRobots
+	c.CheckExternal = *check
+	switch *nofollow {
+	case "follow":
+		c.Nofollow = crawler.NofollowFollow
+	case "skip":
+		c.Nofollow = crawler.NofollowSkip
+	case "report":
+		c.Nofollow = crawler.NofollowReport
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "unknown -nofollow: %s\n", *nofollow)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *extract != "" {
+		sources, errE := parseLinkSources(*extract)
+		if errE != nil {
+			_, _ = fmt.Fprintln(os.Stderr, errE)
+			flag.Usage()
+			os.Exit(2)
+		}
+		c.LinkSources = sources
+	}
+	c.HostLimit = crawler.HostLimit{RequestsPerSecond: *hostRate, Burst: *hostBurst, MaxConnections: *hostConnections}
+	limits, err := hostLimits.parse(c.HostLimit)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	c.HostLimits = limits
+	switch *redirects {
+	case "follow":
+		c.Redirects = crawler.RedirectFollow
+	case "record":
+		c.Redirects = crawler.RedirectRecord
+	case "refuse":
+		c.Redirects = crawler.RedirectRefuse
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "unknown -redirects: %s\n", *redirects)
+		flag.Usage()
+		os.Exit(2)
+	}
+	switch *seenStore {
+	case "memory":
+	case "bloom":
+		c.SeenStore = crawler.NewBloomSeenStore(*bloomSize*1024*1024, *bloomExpected)
+	case "disk":
+		store, err := crawler.NewDiskSeenStore(*seenDir)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "could not create disk seen store: %s\n", err)
+			os.Exit(2)
+		}
+		c.SeenStore = store
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "unknown -seen-store: %s\n", *seenStore)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *noNormalize == true {
+		c.Normalizer = nil
+	} else {
+		c.Normalizer.StripFragment = !*keepFragment
+		c.Normalizer.RemoveParams = splitList(*stripParams)
+		switch *trailingSlash {
+		case "keep":
+			c.Normalizer.TrailingSlash = crawler.TrailingSlashKeep
+		case "add":
+			c.Normalizer.TrailingSlash = crawler.TrailingSlashAdd
+		case "remove":
+			c.Normalizer.TrailingSlash = crawler.TrailingSlashRemove
+		default:
+			_, _ = fmt.Fprintf(os.Stderr, "unknown -trailing-slash: %s\n", *trailingSlash)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+	switch *scope {
+	case "prefix":
+		c.Scope.Mode = crawler.ScopePrefix
+	case "host":
+		c.Scope.Mode = crawler.ScopeHost
+	case "subdomains":
+		c.Scope.Mode = crawler.ScopeSubdomains
+	case "domain":
+		c.Scope.Mode = crawler.ScopeDomain
+	case "all":
+		c.Scope.Mode = crawler.ScopeAll
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "unknown -scope: %s\n", *scope)
+		flag.Usage()
+		os.Exit(2)
+	}
+	c.Scope.PathPrefix = *pathPrefix
+	c.SiteRoot = *siteRoot
+	c.Scope.AnyScheme = *anyScheme
+	c.Scope.IgnoreWww = *ignoreWww
+	c.Scope.AllowHosts = splitList(*allowHosts)
+	c.Scope.DenyHosts = splitList(*denyHosts)
+	c.Rules = urlRules
+	c.Traps = crawler.TrapLimits{MaxPathDepth: *maxPathDepth, MaxRepeatedSegments: *maxRepeatedSegments, MaxQueryVariants: *maxQueryVariants, MaxUrlLength: *maxUrlLength}
+	c.Checkpoint = *checkpoint
+	c.CheckpointInterval = time.Duration(*checkpointInterval) * time.Second
+	// sitemap files are written at the end from everything collected, there is nothing to carry on from
+	if (*checkpoint != "" || *resume != "") && *format == "sitemap-xml" && *check == false {
+		_, _ = fmt.Fprintln(os.Stderr, "-checkpoint and -resume do not support -format sitemap-xml")
+		os.Exit(2)
+	}
 	tail := flag.Args()
+	if *resume != "" {
+		// crawl URL is taken from the checkpoint
+		if len(tail) > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "no URL allowed with -resume: %s\n", tail)
+			flag.Usage()
+			os.Exit(2)
+		}
+		baseUrl, errC := crawler.CheckpointUrl(*resume)
+		if errC != nil {
+			_, _ = fmt.Fprintln(os.Stderr, errC)
+			os.Exit(2)
+		}
+		tail = []string{baseUrl}
+	}
 	if len(tail) == 0 {
 		_, _ = fmt.Fprintln(os.Stderr, "missing url")
 		flag.Usage()
@@ -112,19 +441,127 @@ func main() {
 		os.Exit(2)
 	}
 
-	// print json start/end, setup signal handler and run crawler
-	fmt.Println("[")
-	s := make(chan os.Signal)
-	signal.Notify(s, os.Interrupt)
-	go func() {
-		<-s
-		fmt.Println("]")
-		_, _ = fmt.Fprintln(os.Stderr, "Incomplete: interrupted by signal")
-		os.Exit(1)
-	}()
 	cb := new(Callback)
-	cb.indent = *indent
 	cb.errStderr = *errStdrr
-	c.Crawl(tail[0], cb.callback)
-	fmt.Println("]")
+	var out io.Writer = os.Stdout
+	var outFile *os.File
+	if *output != "" && *format != "sitemap-xml" {
+		// results of a resumed crawl go after the ones reported before the checkpoint, see outputCheckpoint
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if *resume != "" {
+			flags = os.O_WRONLY | os.O_CREATE
+		}
+		f, errO := os.OpenFile(*output, flags, 0644)
+		if errO != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Could not create output file: %s\n", errO)
+			os.Exit(2)
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+		outFile = f
+	}
+	switch {
+	case *check == true && (*format == "json" || *format == "ndjson"):
+		cb.writer = newCheckWriter(out, *indent, *format == "ndjson")
+	case *check == true:
+		_, _ = fmt.Fprintf(os.Stderr, "-check does not support -format %s\n", *format)
+		flag.Usage()
+		os.Exit(2)
+	case *format == "json":
+		cb.writer = newJsonArrayWriter(out, *indent)
+	case *format == "ndjson":
+		cb.writer = newNdjsonWriter(out)
+	case *format == "sitemap-xml":
+		rules, errR := sitemapRules.parse()
+		if errR != nil {
+			_, _ = fmt.Fprintln(os.Stderr, errR)
+			os.Exit(2)
+		}
+		if *output == "" {
+			*output = "sitemap.xml"
+		}
+		sw, errS := newSitemapWriter(*output, c.StartUrl(tail[0]), *sitemapGzip, rules)
+		if errS != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid url: %s\n", errS)
+			os.Exit(2)
+		}
+		if *sitemapBaseUrl != "" {
+			sw.indexBaseUrl = strings.TrimSuffix(*sitemapBaseUrl, "/") + "/"
+		}
+		cb.writer = sw
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "unknown -format: %s\n", *format)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var outCheckpoint *outputCheckpoint
+	if *checkpoint != "" || *resume != "" {
+		outCheckpoint = &outputCheckpoint{file: outFile, writer: cb.writer.(resumableWriter)}
+		c.CheckpointData = outCheckpoint
+	}
+
+	// print output start/end, setup signal handler and run crawler
+	// first SIGINT stops the crawl cleanly, in-flight URLs are still reported and output is closed properly; second one kills us
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if *resume != "" {
+		// output carries on from the checkpoint, once it is loaded
+		err = c.Resume(ctx, *resume, cb.callback)
+	} else {
+		err = cb.writer.begin()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Could not write output: %s\n", err)
+			os.Exit(1)
+		}
+		err = c.CrawlContext(ctx, tail[0], cb.callback)
+	}
+	// output of a checkpoint which could not be loaded is left alone
+	if *resume == "" || outCheckpoint.loaded == true {
+		errW := cb.writer.end()
+		if errW != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Could not write output: %s\n", errW)
+		}
+	}
+	if c.SeenStore != nil {
+		_ = c.SeenStore.Close()
+	}
+	if err != nil {
+		// interrupted crawl may come with other errors, e.g. saving the checkpoint, joined to it
+		errs := []error{err}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = joined.Unwrap()
+		}
+		for _, e := range errs {
+			var incomplete *crawler.IncompleteCrawlError
+			if errors.As(e, &incomplete) == false {
+				_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", e)
+				continue
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "Incomplete: interrupted by signal: %s\n", incomplete)
+			if c.Checkpoint != "" || *resume != "" {
+				_, _ = fmt.Fprintln(os.Stderr, "Continue with -resume and the checkpoint file")
+			}
+		}
+		os.Exit(1)
+	}
+	if cw, ok := cb.writer.(*checkWriter); ok {
+		// not broken, but not checked either, so the result is incomplete
+		failures := cw.failures()
+		for _, failure := range failures {
+			_, _ = fmt.Fprintf(os.Stderr, "Could not check %s\n", failure)
+		}
+		if cw.brokenCount() > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Found %d broken links\n", cw.brokenCount())
+		}
+		if len(failures) > 0 {
+			os.Exit(1)
+		}
+		if cw.brokenCount() > 0 {
+			os.Exit(3)
+		}
+	}
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"errors"
-	"fmt"
 	"io"
 	"os"
 	"testing"
@@ -12,7 +11,6 @@ import "./crawler"
 
 func TestCallback(t *testing.T) {
 	cb := new(Callback)
-	cb.indent = false
 	cb.errStderr = false
 	aurl := "testB"
 	u := crawler.FoundUrls{CrawlUrl:"testA",FoundUrls:[]*string{&aurl},Err:errors.New("testC")}
@@ -28,6 +26,7 @@ func TestCallback(t *testing.T) {
 		t.FailNow()
 	}
 	os.Stderr = wErr
+	cb.writer = newJsonArrayWriter(os.Stdout, false)
 	cb.callback(&u)
 	os.Stdout = stdout
 	os.Stderr = stderr
@@ -46,8 +45,7 @@ func TestCallback(t *testing.T) {
 	_ = rOut.Close()
 	_ = rErr.Close()
 	out := bufOut.String()
-	a := `{"CrawledUrl":"testA","FoundUrls":["testB"],"Depth":0,"Error":"testC"},`
-	a = fmt.Sprintf("%s\n", a)
+	a := `{"CrawledUrl":"testA","FoundUrls":["testB"],"Depth":0,"Error":"testC"}`
 	if out != a {
 		t.Errorf("stdout: %s", out)
 		t.FailNow()
@@ -61,7 +59,6 @@ func TestCallback(t *testing.T) {
 
 func TestCallbackIndent(t *testing.T) {
 	cb := new(Callback)
-	cb.indent = true
 	cb.errStderr = false
 	aurl := "testB"
 	u := crawler.FoundUrls{CrawlUrl:"testA",FoundUrls:[]*string{&aurl},Err:errors.New("testC")}
@@ -77,6 +74,7 @@ func TestCallbackIndent(t *testing.T) {
 		t.FailNow()
 	}
 	os.Stderr = wErr
+	cb.writer = newJsonArrayWriter(os.Stdout, true)
 	cb.callback(&u)
 	os.Stdout = stdout
 	os.Stderr = stderr
@@ -102,8 +100,7 @@ func TestCallbackIndent(t *testing.T) {
 	],
 	"Depth": 0,
 	"Error": "testC"
-},
-`
+}`
 	if out != a {
 		t.Errorf("stdout: %s", out)
 		t.FailNow()
@@ -117,7 +114,6 @@ func TestCallbackIndent(t *testing.T) {
 
 func TestCallbackIndentStderr(t *testing.T) {
 	cb := new(Callback)
-	cb.indent = true
 	cb.errStderr = true
 	aurl := "testB"
 	u := crawler.FoundUrls{CrawlUrl:"testA",FoundUrls:[]*string{&aurl},Err:errors.New("testC")}
@@ -133,6 +129,7 @@ func TestCallbackIndentStderr(t *testing.T) {
 		t.FailNow()
 	}
 	os.Stderr = wErr
+	cb.writer = newJsonArrayWriter(os.Stdout, true)
 	cb.callback(&u)
 	os.Stdout = stdout
 	os.Stderr = stderr
@@ -158,8 +155,7 @@ func TestCallbackIndentStderr(t *testing.T) {
 	],
 	"Depth": 0,
 	"Error": "testC"
-},
-`
+}`
 	if out != a {
 		t.Errorf("stdout: %s", out)
 		t.FailNow()
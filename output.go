@@ -0,0 +1,245 @@
+package main
+
+import (
+	"./crawler"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// writes crawl results to output as they come in
+// write is called from the crawler callback, so it must be safe for concurrent use
+type resultWriter interface {
+	begin() error
+	write(u *crawler.FoundUrls) error
+	end() error
+}
+
+// copies crawler.FoundUrls to JsonOutput
+func newJsonOutput(u *crawler.FoundUrls) (nu *JsonOutput) {
+	nu = new(JsonOutput)
+	nu.CrawledUrl = u.CrawlUrl
+	nu.FoundUrls = u.FoundUrls
+	nu.Links = u.Links
+	nu.NofollowLinks = u.NofollowLinks
+	nu.Depth = u.Depth
+	nu.Redirects = u.Redirects
+	nu.Skipped = u.Skipped
+	nu.Sitemaps = u.Sitemaps
+	nu.FinalUrl = u.FinalUrl
+	nu.StatusCode = u.StatusCode
+	nu.ContentType = u.ContentType
+	nu.NearDuplicateOf = u.NearDuplicateOf
+	nu.Referrer = u.Referrer
+	nu.Attempts = u.Attempts
+	nu.CheckOnly = u.CheckOnly
+	nu.ContentLength = u.ContentLength
+	nu.BytesRead = u.BytesRead
+	nu.Headers = u.Headers
+	if u.Timings != nil {
+		ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+		nu.Timings = &JsonTimings{DNS: ms(u.Timings.DNS), Connect: ms(u.Timings.Connect), TLS: ms(u.Timings.TLS), TTFB: ms(u.Timings.TTFB), Total: ms(u.Timings.Total)}
+	}
+	if u.LastModified.IsZero() == false {
+		nu.LastModified = u.LastModified.UTC().Format(time.RFC3339)
+	}
+	if u.Err != nil {
+		nu.Error = u.Err.Error()
+	}
+	for _, err := range u.LinkErrors {
+		nu.LinkErrors = append(nu.LinkErrors, err.Error())
+	}
+	return
+}
+
+// streams a single json array, elements separated by ",\n"
+type jsonArrayWriter struct {
+	out    io.Writer
+	indent bool
+	mutex  *sync.Mutex
+	count  int
+}
+
+func newJsonArrayWriter(out io.Writer, indent bool) (w *jsonArrayWriter) {
+	w = new(jsonArrayWriter)
+	w.out = out
+	w.indent = indent
+	w.mutex = &sync.Mutex{}
+	return
+}
+
+func (w *jsonArrayWriter) begin() (err error) {
+	_, err = io.WriteString(w.out, "[\n")
+	return
+}
+
+func (w *jsonArrayWriter) write(u *crawler.FoundUrls) (err error) {
+	var b []byte
+	if w.indent == true {
+		b, err = json.MarshalIndent(newJsonOutput(u), "", "\t")
+	} else {
+		b, err = json.Marshal(newJsonOutput(u))
+	}
+	if err != nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	// separator goes before every element but the first, so there is never a trailing comma
+	if w.count > 0 {
+		_, err = io.WriteString(w.out, ",\n")
+		if err != nil {
+			return
+		}
+	}
+	_, err = w.out.Write(b)
+	w.count += 1
+	return
+}
+
+// number of elements written, so the array carries on with a separator
+type jsonArrayState struct {
+	Count int
+}
+
+func (w *jsonArrayWriter) saveState() ([]byte, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return json.Marshal(&jsonArrayState{Count: w.count})
+}
+
+func (w *jsonArrayWriter) loadState(state []byte, continued bool) (err error) {
+	if continued == false {
+		return w.begin()
+	}
+	saved := new(jsonArrayState)
+	err = json.Unmarshal(state, saved)
+	if err != nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.count = saved.Count
+	return
+}
+
+func (w *jsonArrayWriter) end() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.count > 0 {
+		_, err = io.WriteString(w.out, "\n")
+		if err != nil {
+			return
+		}
+	}
+	_, err = io.WriteString(w.out, "]\n")
+	return
+}
+
+// newline delimited json, one object per line, no wrapper
+type ndjsonWriter struct {
+	out   io.Writer
+	mutex *sync.Mutex
+}
+
+func newNdjsonWriter(out io.Writer) (w *ndjsonWriter) {
+	w = new(ndjsonWriter)
+	w.out = out
+	w.mutex = &sync.Mutex{}
+	return
+}
+
+func (w *ndjsonWriter) begin() error {
+	return nil
+}
+
+func (w *ndjsonWriter) write(u *crawler.FoundUrls) (err error) {
+	b, err := json.Marshal(newJsonOutput(u))
+	if err != nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err = w.out.Write(append(b, '\n'))
+	return
+}
+
+func (w *ndjsonWriter) end() error {
+	return nil
+}
+
+func (w *ndjsonWriter) saveState() ([]byte, error) {
+	return nil, nil
+}
+
+func (w *ndjsonWriter) loadState(state []byte, continued bool) error {
+	return nil
+}
+
+// resultWriter which can carry on after -resume, its state is saved in the crawl checkpoint by outputCheckpoint
+type resumableWriter interface {
+	resultWriter
+	// state needed to carry on writing, nil if there is none
+	saveState() ([]byte, error)
+	// restores what saveState returned, instead of begin(); continued is false when the output starts over, e.g. on stdout
+	loadState(state []byte, continued bool) error
+}
+
+// how far the output got when the checkpoint was saved
+// Offset is -1 when writing to stdout, which cannot be cut back
+type savedOutput struct {
+	Offset int64
+	Writer json.RawMessage `json:",omitempty"`
+}
+
+// crawler.CheckpointData keeping -output in step with the checkpoint
+// on -resume, output written after the checkpoint was saved is cut off, as those URLs are reported again
+type outputCheckpoint struct {
+	file   *os.File
+	writer resumableWriter
+	loaded bool
+}
+
+func (o *outputCheckpoint) Save(w io.Writer) (err error) {
+	state := &savedOutput{Offset: -1}
+	if o.file != nil {
+		state.Offset, err = o.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return
+		}
+	}
+	state.Writer, err = o.writer.saveState()
+	if err != nil {
+		return
+	}
+	return json.NewEncoder(w).Encode(state)
+}
+
+func (o *outputCheckpoint) Load(r io.Reader) (err error) {
+	state := new(savedOutput)
+	err = json.NewDecoder(r).Decode(state)
+	if err != nil {
+		return fmt.Errorf("no output state: %s", err)
+	}
+	// output on stdout, or a file written from the start
+	continued := o.file != nil && state.Offset >= 0
+	if o.file != nil {
+		offset := state.Offset
+		if continued == false {
+			offset = 0
+		}
+		err = o.file.Truncate(offset)
+		if err == nil {
+			_, err = o.file.Seek(offset, io.SeekStart)
+		}
+		if err != nil {
+			return
+		}
+	}
+	err = o.writer.loadState(state.Writer, continued)
+	o.loaded = err == nil
+	return
+}
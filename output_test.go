@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+import "./crawler"
+
+func TestJsonArrayWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newJsonArrayWriter(&buf, false)
+	if w.begin() != nil || w.end() != nil {
+		t.FailNow()
+	}
+	if buf.String() != "[\n]\n" {
+		t.Errorf("empty: %s", buf.String())
+		t.FailNow()
+	}
+	buf.Reset()
+	w = newJsonArrayWriter(&buf, true)
+	_ = w.begin()
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testA"})
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testB", Err: errors.New("testC"), CheckOnly: true})
+	_ = w.end()
+	var out []JsonOutput
+	err := json.Unmarshal(buf.Bytes(), &out)
+	if err != nil || len(out) != 2 || out[1].Error != "testC" || out[0].CheckOnly == true || out[1].CheckOnly == false {
+		t.Errorf("%s: %s", err, buf.String())
+		t.FailNow()
+	}
+}
+
+func TestNdjsonWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newNdjsonWriter(&buf)
+	_ = w.begin()
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testA"})
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testB"})
+	_ = w.end()
+	a := `{"CrawledUrl":"testA","FoundUrls":null,"Depth":0,"Error":""}
+{"CrawledUrl":"testB","FoundUrls":null,"Depth":0,"Error":""}
+`
+	if buf.String() != a {
+		t.Errorf("%s", buf.String())
+		t.FailNow()
+	}
+}
+
+func TestOutputCheckpoint(t *testing.T) {
+	// json array interrupted after a checkpoint, with a result written after it: resumed output is a single array, each URL once
+	path := filepath.Join(t.TempDir(), "out.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newJsonArrayWriter(f, false)
+	o := &outputCheckpoint{file: f, writer: w}
+	_ = w.begin()
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testA"})
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testB"})
+	var saved bytes.Buffer
+	if err = o.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	// reported again after resuming
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testC"})
+	_ = w.end()
+	_ = f.Close()
+
+	f, err = os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = newJsonArrayWriter(f, false)
+	o = &outputCheckpoint{file: f, writer: w}
+	if err = o.Load(&saved); err != nil || o.loaded == false {
+		t.Fatal(err)
+	}
+	_ = w.write(&crawler.FoundUrls{CrawlUrl: "testC"})
+	_ = w.end()
+	_ = f.Close()
+	b, _ := os.ReadFile(path)
+	var out []JsonOutput
+	err = json.Unmarshal(b, &out)
+	if err != nil || len(out) != 3 || out[2].CrawledUrl != "testC" {
+		t.Errorf("%s: %s", err, b)
+	}
+
+	// on stdout the array starts over
+	var buf bytes.Buffer
+	w = newJsonArrayWriter(&buf, false)
+	o = &outputCheckpoint{writer: w}
+	saved.Reset()
+	_ = o.Save(&saved)
+	if err = o.Load(&saved); err != nil || buf.String() != "[\n" {
+		t.Errorf("stdout: %v %q", err, buf.String())
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"./crawler"
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sitemaps.org limits for a single sitemap file, size is uncompressed
+const (
+	sitemapMaxUrls  = 50000
+	sitemapMaxBytes = 50 * 1024 * 1024
+)
+
+const sitemapUrlsetStart = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+`
+const sitemapUrlsetEnd = "</urlset>\n"
+
+// changefreq and priority for URLs matching a regex, first matching rule wins
+type sitemapRule struct {
+	match      *regexp.Regexp
+	changefreq string
+	priority   string
+}
+
+// repeatable -sitemap-rule flag, regex=changefreq[,priority]
+type sitemapRuleFlags []string
+
+func (s *sitemapRuleFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *sitemapRuleFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// parses -sitemap-rule values, the regex is everything up to the last '='
+func (s *sitemapRuleFlags) parse() (rules []*sitemapRule, err error) {
+	changefreqs := map[string]bool{"": true, "always": true, "hourly": true, "daily": true, "weekly": true, "monthly": true, "yearly": true, "never": true}
+	for _, value := range *s {
+		i := strings.LastIndex(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("-sitemap-rule %s: expected regex=changefreq[,priority]", value)
+		}
+		rule := new(sitemapRule)
+		rule.match, err = regexp.Compile(value[:i])
+		if err != nil {
+			return nil, fmt.Errorf("-sitemap-rule %s: %s", value, err)
+		}
+		parts := strings.SplitN(value[i+1:], ",", 2)
+		rule.changefreq = parts[0]
+		if changefreqs[rule.changefreq] == false {
+			return nil, fmt.Errorf("-sitemap-rule %s: invalid changefreq %s", value, rule.changefreq)
+		}
+		if len(parts) == 2 {
+			p, errP := strconv.ParseFloat(parts[1], 64)
+			if errP != nil || p < 0 || p > 1 {
+				return nil, fmt.Errorf("-sitemap-rule %s: priority must be between 0.0 and 1.0", value)
+			}
+			rule.priority = strconv.FormatFloat(p, 'f', 1, 64)
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// writes sitemaps.org urlset files, splitting into output-1.xml, output-2.xml, ... plus a sitemapindex in output
+// when the URL or size limit is reached; a single file is simply written to output
+// only successfully crawled text/html pages are listed, pages only checked for existence are not, as they are out of crawl scope
+// sitemaps.org only allows URLs on the host of the sitemap, so pages on other hosts than baseUrl are left out too
+// indexBaseUrl is where the part files will be published, defaults to baseUrl
+type sitemapWriter struct {
+	output       string
+	baseUrl      string
+	indexBaseUrl string
+	gzip         bool
+	rules        []*sitemapRule
+	mutex        *sync.Mutex
+	parts        []string
+	file         *os.File
+	gz           *gzip.Writer
+	buf          *bufio.Writer
+	urls         int
+	bytes        int
+	maxUrls      int
+	maxSize      int
+}
+
+// creates sitemap writer, baseUrl is the normalized seed URL, see Crawler.StartUrl, only its scheme://host/ prefix is used
+func newSitemapWriter(output string, baseUrl string, gz bool, rules []*sitemapRule) (w *sitemapWriter, err error) {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	w = new(sitemapWriter)
+	w.output = output
+	w.baseUrl = u.Scheme + "://" + u.Host + "/"
+	w.indexBaseUrl = w.baseUrl
+	w.gzip = gz
+	w.rules = rules
+	w.mutex = &sync.Mutex{}
+	w.maxUrls = sitemapMaxUrls
+	w.maxSize = sitemapMaxBytes
+	return
+}
+
+// name of part n (counting from 1), output with "-n" added before the extension
+func (w *sitemapWriter) partName(n int) string {
+	base := strings.TrimSuffix(w.output, ".gz")
+	ext := filepath.Ext(base)
+	name := fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), n, ext)
+	if w.gzip == true {
+		name += ".gz"
+	}
+	return name
+}
+
+func (w *sitemapWriter) begin() error {
+	return nil
+}
+
+func (w *sitemapWriter) write(u *crawler.FoundUrls) (err error) {
+	loc := u.FinalUrl
+	if loc == "" {
+		loc = u.CrawlUrl
+	}
+	if u.Err != nil || u.Skipped != "" || u.CheckOnly == true || u.StatusCode < 200 || u.StatusCode >= 300 {
+		return
+	}
+	if strings.HasPrefix(u.ContentType, "text/html") == false || strings.HasPrefix(loc, w.baseUrl) == false {
+		return
+	}
+	var entry strings.Builder
+	entry.WriteString("\t<url>\n\t\t<loc>")
+	_ = xml.EscapeText(&entry, []byte(loc))
+	entry.WriteString("</loc>\n")
+	if u.LastModified.IsZero() == false {
+		entry.WriteString("\t\t<lastmod>" + u.LastModified.UTC().Format(time.RFC3339) + "</lastmod>\n")
+	}
+	for _, rule := range w.rules {
+		if rule.match.MatchString(loc) {
+			if rule.changefreq != "" {
+				entry.WriteString("\t\t<changefreq>" + rule.changefreq + "</changefreq>\n")
+			}
+			if rule.priority != "" {
+				entry.WriteString("\t\t<priority>" + rule.priority + "</priority>\n")
+			}
+			break
+		}
+	}
+	entry.WriteString("\t</url>\n")
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file != nil && (w.urls >= w.maxUrls || w.bytes+entry.Len()+len(sitemapUrlsetEnd) > w.maxSize) {
+		err = w.closePart()
+		if err != nil {
+			return
+		}
+	}
+	if w.file == nil {
+		err = w.openPart()
+		if err != nil {
+			return
+		}
+	}
+	_, err = w.buf.WriteString(entry.String())
+	w.urls += 1
+	w.bytes += entry.Len()
+	return
+}
+
+// starts next part file and writes urlset header; caller holds the mutex
+func (w *sitemapWriter) openPart() (err error) {
+	name := w.partName(len(w.parts) + 1)
+	w.file, err = os.Create(name)
+	if err != nil {
+		return
+	}
+	w.parts = append(w.parts, name)
+	var out io.Writer = w.file
+	if w.gzip == true {
+		w.gz = gzip.NewWriter(w.file)
+		out = w.gz
+	}
+	w.buf = bufio.NewWriter(out)
+	_, err = w.buf.WriteString(sitemapUrlsetStart)
+	w.urls = 0
+	w.bytes = len(sitemapUrlsetStart)
+	return
+}
+
+// writes urlset footer and closes current part; caller holds the mutex
+func (w *sitemapWriter) closePart() (err error) {
+	_, err = w.buf.WriteString(sitemapUrlsetEnd)
+	if err == nil {
+		err = w.buf.Flush()
+	}
+	if err == nil && w.gz != nil {
+		err = w.gz.Close()
+	}
+	errC := w.file.Close()
+	if err == nil {
+		err = errC
+	}
+	w.file = nil
+	w.gz = nil
+	return
+}
+
+// closes the last part; a single part is renamed to output, more parts get a sitemapindex written to output
+func (w *sitemapWriter) end() (err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil && len(w.parts) == 0 {
+		// nothing crawled, still write an empty, valid urlset
+		err = w.openPart()
+		if err != nil {
+			return
+		}
+	}
+	if w.file != nil {
+		err = w.closePart()
+		if err != nil {
+			return
+		}
+	}
+	if len(w.parts) == 1 {
+		output := w.output
+		if w.gzip == true && strings.HasSuffix(output, ".gz") == false {
+			output += ".gz"
+		}
+		return os.Rename(w.parts[0], output)
+	}
+	return w.writeIndex()
+}
+
+// writes sitemapindex listing all parts, published under indexBaseUrl
+func (w *sitemapWriter) writeIndex() (err error) {
+	file, err := os.Create(w.output)
+	if err != nil {
+		return
+	}
+	buf := bufio.NewWriter(file)
+	_, _ = buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+`)
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, part := range w.parts {
+		_, _ = buf.WriteString("\t<sitemap>\n\t\t<loc>")
+		_ = xml.EscapeText(buf, []byte(w.indexBaseUrl+url.PathEscape(filepath.Base(part))))
+		_, _ = buf.WriteString("</loc>\n\t\t<lastmod>" + now + "</lastmod>\n\t</sitemap>\n")
+	}
+	_, _ = buf.WriteString("</sitemapindex>\n")
+	err = buf.Flush()
+	errC := file.Close()
+	if err == nil {
+		err = errC
+	}
+	return
+}
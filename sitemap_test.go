@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+import "./crawler"
+
+func TestSitemapWriter(t *testing.T) {
+	c := crawler.NewCrawler()
+	c.IgnoreRobots = true
+	c.CheckExternal = true
+	c.Fetcher = crawler.NewMemoryFetcher(map[string]*crawler.MemoryPage{
+		"http://example.com/":        {Body: `<a href="/page">page</a><a href="http://other.com/">other</a><img src="/img.png">`},
+		"http://example.com/page":    {Body: `<html>page</html>`},
+		"http://other.com/":          {Body: `<html>other</html>`},
+		"http://example.com/img.png": {Header: map[string][]string{"Content-Type": {"image/png"}}},
+	})
+	output := filepath.Join(t.TempDir(), "sitemap.xml")
+	// seed as typed by the user, not normalized
+	seed := "HTTP://Example.com:80"
+	sw, err := newSitemapWriter(output, c.StartUrl(seed), false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Crawl(seed, func(u *crawler.FoundUrls) {
+		_ = sw.write(u)
+	})
+	if err = sw.end(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sitemap := string(b)
+	for _, loc := range []string{"http://example.com/", "http://example.com/page"} {
+		if strings.Contains(sitemap, "<loc>"+loc+"</loc>") == false {
+			t.Errorf("%s not in sitemap:\n%s", loc, sitemap)
+		}
+	}
+	if strings.Count(sitemap, "<loc>") != 2 {
+		t.Errorf("expected 2 URLs in sitemap:\n%s", sitemap)
+	}
+}